@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"example.com/cjon/interpreter-starter-go/pkg/format"
+)
+
+// formatCommand runs "fmt [flags] [file ...]", formatting stdin when no
+// files are named, and returns the exit status: 65 if a file does not
+// parse, 1 if -check found unformatted files or on a usage error.
+func formatCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result back to each file instead of printing it")
+	diff := flags.Bool("d", false, "print a diff of the changes instead of the result")
+	check := flags.Bool("check", false, "list the files that are not formatted and exit with status 1 if there are any")
+	width := flags.Int("width", format.DefaultWidth, "wrap lines at this column where possible")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: ./your_program.sh fmt [-w] [-d] [-check] [-width N] [file ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	status := 0
+	for _, name := range files {
+		var src []byte
+		var err error
+		if name == "-" {
+			src, err = io.ReadAll(stdin)
+		} else {
+			src, err = os.ReadFile(name)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading file: %v\n", err)
+			status = max(status, 1)
+			continue
+		}
+
+		out, errs := format.Source(src, format.Options{Width: *width, Mode: lexMode()})
+		if len(errs) > 0 {
+			rep := newReporter(name, src)
+			rep.w = stderr
+			for _, e := range errs {
+				rep.report(e)
+			}
+			status = 65
+			continue
+		}
+
+		changed := !bytes.Equal(src, out)
+		if *check && changed {
+			fmt.Fprintln(stdout, name)
+			status = max(status, 1)
+		}
+		if *diff && changed {
+			writeDiff(stdout, name, src, out)
+		}
+		if *write && changed && name != "-" {
+			if err := os.WriteFile(name, out, 0o644); err != nil {
+				fmt.Fprintf(stderr, "Error writing file: %v\n", err)
+				status = max(status, 1)
+			}
+		}
+		if !*check && !*diff && (!*write || name == "-") {
+			stdout.Write(out)
+		}
+	}
+	return status
+}
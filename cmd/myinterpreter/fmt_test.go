@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatCommand(t *testing.T) {
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.lox")
+	tidy := filepath.Join(dir, "tidy.lox")
+	os.WriteFile(messy, []byte("print 1+2;\nvar  x=3;\n"), 0o644)
+	os.WriteFile(tidy, []byte("print 1;\n"), 0o644)
+
+	run := func(args ...string) (int, string, string) {
+		var out, errOut strings.Builder
+		status := formatCommand(args, strings.NewReader("if(x)print x;"), &out, &errOut)
+		return status, out.String(), errOut.String()
+	}
+
+	if status, out, _ := run("-check", messy, tidy); status != 1 || out != messy+"\n" {
+		t.Errorf("-check: expected status 1 listing %s, got %d and %q", messy, status, out)
+	}
+	if status, out, _ := run("-d", messy); status != 0 || !strings.Contains(out, "-print 1+2;\n-var  x=3;\n+print 1 + 2;\n+var x = 3;\n") {
+		t.Errorf("-d: unexpected status %d and diff %q", status, out)
+	}
+	if status, out, _ := run(); status != 0 || out != "if (x)\n  print x;\n" {
+		t.Errorf("stdin: unexpected status %d and output %q", status, out)
+	}
+	if status, _, _ := run("-w", messy, tidy); status != 0 {
+		t.Errorf("-w: unexpected status %d", status)
+	}
+	if written, _ := os.ReadFile(messy); string(written) != "print 1 + 2;\nvar x = 3;\n" {
+		t.Errorf("-w: file contains %q", written)
+	}
+	if status, out, _ := run("-check", messy, tidy); status != 0 || out != "" {
+		t.Errorf("-check after -w: expected status 0, got %d and %q", status, out)
+	}
+
+	unterminated := filepath.Join(dir, "unterminated.lox")
+	os.WriteFile(unterminated, []byte("print 1;"), 0o644)
+	if status, out, _ := run("-d", unterminated); status != 0 || !strings.Contains(out, "@@ -1,1 +1,1 @@\n-print 1;\n\\ No newline at end of file\n+print 1;\n") {
+		t.Errorf("-d without a final newline: unexpected status %d and diff %q", status, out)
+	}
+
+	broken := filepath.Join(dir, "broken.lox")
+	os.WriteFile(broken, []byte("print ;"), 0o644)
+	if status, _, errOut := run(broken); status != 65 || errOut != "[line 1] Error at ';': Expect expression.\n" {
+		t.Errorf("syntax error: expected status 65, got %d and %q", status, errOut)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	cases := [][2]string{
+		{"", ""},
+		{"a\nb\nc", "a\nb\nc"},
+		{"", "a\nb"},
+		{"a\nb", ""},
+		{"a\nb\nc\nd", "a\nx\nc\ny\nd"},
+		{"x\na\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc"},
+	}
+	for _, c := range cases {
+		before, after := splitLines([]byte(c[0])), splitLines([]byte(c[1]))
+		var gotBefore, gotAfter []string
+		for _, e := range diffLines(before, after) {
+			if e.op != '+' {
+				gotBefore = append(gotBefore, e.line)
+			}
+			if e.op != '-' {
+				gotAfter = append(gotAfter, e.line)
+			}
+		}
+		if strings.Join(gotBefore, "") != c[0] || strings.Join(gotAfter, "") != c[1] {
+			t.Errorf("%q -> %q: edit script gives %q -> %q", c[0], c[1], gotBefore, gotAfter)
+		}
+	}
+}
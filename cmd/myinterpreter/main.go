@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 
 	"example.com/cjon/interpreter-starter-go/pkg/parser"
@@ -18,8 +21,17 @@ func (a ArgumentError) Error() string {
 }
 
 func main() {
+	if len(os.Args) < 2 || os.Args[1] == "repl" {
+		runREPL(os.Stdin, os.Stdout, os.Stderr, historyPath())
+		os.Exit(0)
+	}
+	if os.Args[1] == "fmt" {
+		os.Exit(formatCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
 	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh tokenize <filename>")
+		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh <tokenize|parse|evaluate|run> <filename|->")
+		fmt.Fprintln(os.Stderr, "       ./your_program.sh fmt [-w] [-d] [-check] [-width N] [file ...]")
+		fmt.Fprintln(os.Stderr, "       ./your_program.sh [repl]")
 		os.Exit(1)
 	}
 
@@ -29,23 +41,30 @@ func main() {
 	switch command {
 	case "tokenize":
 		tokenCh := make(chan token.Struct)
-		lines := getLines(os.Args[2])
-		go tokenizer.Tokenize(tokenCh, lines)
-		err = printTokens(tokenCh)
+		input, source := openSource(os.Args[2])
+		go tokenize(tokenCh, input)
+		err = printTokens(tokenCh, newReporter(os.Args[2], source))
 	case "parse":
 		tokenCh := make(chan token.Struct)
 		parserCh := make(chan parser.ASTnode)
-		lines := getLines(os.Args[2])
-		go tokenizer.Tokenize(tokenCh, lines)
+		input, source := openSource(os.Args[2])
+		go tokenize(tokenCh, input)
 		go parser.Parse(tokenCh, parserCh)
-		err = printAST(parserCh)
+		err = printAST(parserCh, newReporter(os.Args[2], source))
 	case "evaluate":
 		tokenCh := make(chan token.Struct)
 		parserCh := make(chan parser.ASTnode)
-		lines := getLines(os.Args[2])
-		go tokenizer.Tokenize(tokenCh, lines)
+		input, source := openSource(os.Args[2])
+		go tokenize(tokenCh, input)
 		go parser.Parse(tokenCh, parserCh)
-		err = evaluateAST(parserCh)
+		err = evaluateAST(parserCh, newReporter(os.Args[2], source))
+	case "run":
+		tokenCh := make(chan token.Struct)
+		stmtCh := make(chan parser.ASTstmt)
+		input, source := openSource(os.Args[2])
+		go tokenize(tokenCh, input)
+		go parser.ParseProgram(tokenCh, stmtCh)
+		err = runProgram(stmtCh, newReporter(os.Args[2], source))
 	default:
 		err = errors.New("argument_error")
 	}
@@ -57,26 +76,57 @@ func main() {
 	switch err.(type) {
 	case ArgumentError:
 		os.Exit(1)
+	case parser.RuntimeError:
+		os.Exit(70)
 	default:
 		os.Exit(65)
 	}
 }
 
-func getLines(filename string) []byte {
-	lines, err := os.ReadFile(filename)
+// tokenize runs the tokenizer over input. Setting LOX_EXTENDED=1 switches
+// on the extended lexical mode: string escapes, Unicode identifiers,
+// block comments and the extra number forms.
+func tokenize(tokens chan<- token.Struct, input io.Reader) {
+	tokenizer.TokenizeMode(context.Background(), tokens, input, lexMode())
+}
+
+func lexMode() tokenizer.Mode {
+	if os.Getenv("LOX_EXTENDED") == "1" {
+		return tokenizer.Extended
+	}
+	return 0
+}
+
+// openSource opens filename, or stdin when it is "-", for the tokenizer to
+// stream from. Rich diagnostics quote the source, so in that mode the whole
+// input is read up front and returned as well.
+func openSource(filename string) (io.Reader, []byte) {
+	var input io.Reader = os.Stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			os.Exit(1)
+		}
+		input = f
+	}
+	if !richDiagnostics() {
+		return input, nil
+	}
+	source, err := io.ReadAll(input)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 		os.Exit(1)
 	}
-	return lines
+	return bytes.NewReader(source), source
 }
 
-func printTokens(tokens <-chan token.Struct) error {
+func printTokens(tokens <-chan token.Struct, rep reporter) error {
 	var err error
 	for t := range tokens {
 		if t.Type == token.ERROR {
-			fmt.Fprint(os.Stderr, t.Literal)
-			err = errors.New(t.Literal)
+			rep.report(t.Err)
+			err = t.Err
 		} else {
 			fmt.Println(t)
 		}
@@ -84,14 +134,13 @@ func printTokens(tokens <-chan token.Struct) error {
 	return err
 }
 
-func printAST(astNodes <-chan parser.ASTnode) error {
+func printAST(astNodes <-chan parser.ASTnode, rep reporter) error {
 	var err error
 	initial := true
 	for node := range astNodes {
-		_, ok := node.(parser.ASTerror) // so ugly
-		if ok {
-			fmt.Fprintln(os.Stderr, node.String())
-			err = errors.New(node.String())
+		if e, ok := node.(parser.ASTerror); ok {
+			rep.report(e.Err())
+			err = e.Err()
 			continue
 		}
 		if initial {
@@ -104,14 +153,28 @@ func printAST(astNodes <-chan parser.ASTnode) error {
 	return err
 }
 
-func evaluateAST(astNodes <-chan parser.ASTnode) error {
+func evaluateAST(astNodes <-chan parser.ASTnode, rep reporter) error {
 	var err error
-	initial := true
+	nodes := []parser.ASTnode{}
 	for node := range astNodes {
-		_, ok := node.(parser.ASTerror)
-		if ok {
-			fmt.Fprintln(os.Stderr, node.Evaluate())
-			err = errors.New(node.String())
+		if e, ok := node.(parser.ASTerror); ok {
+			rep.report(e.Err())
+			err = e.Err()
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	if err != nil {
+		return err
+	}
+
+	initial := true
+	env := parser.NewGlobalEnvironment()
+	for _, node := range nodes {
+		value, evalErr := node.Evaluate(env)
+		if evalErr != nil {
+			rep.report(evalErr)
+			err = evalErr
 			continue
 		}
 		if initial {
@@ -119,7 +182,50 @@ func evaluateAST(astNodes <-chan parser.ASTnode) error {
 		} else {
 			fmt.Print(" ")
 		}
-		fmt.Println(node.Evaluate())
+		fmt.Println(value)
 	}
 	return err
 }
+
+// collectProgram drains stmts, separating syntax errors from statements.
+func collectProgram(stmts <-chan parser.ASTstmt) ([]parser.ASTstmt, []error) {
+	program := []parser.ASTstmt{}
+	var errs []error
+	for stmt := range stmts {
+		if e, ok := stmt.(parser.ASTerror); ok {
+			errs = append(errs, e.Err())
+			continue
+		}
+		program = append(program, stmt)
+	}
+	return program, errs
+}
+
+func runProgram(stmts <-chan parser.ASTstmt, rep reporter) error {
+	program, errs := collectProgram(stmts)
+	if len(errs) > 0 {
+		for _, e := range errs {
+			rep.report(e)
+		}
+		return errs[0]
+	}
+	return execute(program, parser.NewGlobalEnvironment(), rep)
+}
+
+// execute resolves program and runs it in env, reporting the first error.
+func execute(program []parser.ASTstmt, env *parser.Environment, rep reporter) error {
+	if errs := parser.Resolve(program); len(errs) > 0 {
+		for _, e := range errs {
+			rep.report(e)
+		}
+		return errs[0]
+	}
+
+	for _, stmt := range program {
+		if err := stmt.Execute(env); err != nil {
+			rep.report(err)
+			return err
+		}
+	}
+	return nil
+}
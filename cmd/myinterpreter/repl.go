@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"example.com/cjon/interpreter-starter-go/pkg/parser"
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+)
+
+// historyPath is where entered code is appended: $LOX_HISTORY if set,
+// otherwise ~/.lox_history. An empty result disables history.
+//
+// The history is a transcript only. The REPL reads plain lines, with no
+// line editing, so it never loads the file or recalls entries from it.
+// Since each entry is saved exactly as typed, a session can be replayed
+// by feeding the file back in: myinterpreter repl < ~/.lox_history.
+func historyPath() string {
+	if path, ok := os.LookupEnv("LOX_HISTORY"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".lox_history")
+}
+
+// runREPL reads code from in until EOF, running each complete entry in a
+// single global environment so declarations persist between entries. An
+// entry spans several lines while its parentheses or braces are
+// unbalanced. Bare expressions have their value printed, and errors are
+// reported without ending the session.
+func runREPL(in io.Reader, out, errOut io.Writer, history string) {
+	var historyFile *os.File
+	if history != "" {
+		f, err := os.OpenFile(history, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err == nil {
+			historyFile = f
+			defer historyFile.Close()
+		}
+	}
+
+	env := parser.NewGlobalEnvironment()
+	env.SetOutput(out)
+	scanner := bufio.NewScanner(in)
+	var entry []byte
+	fmt.Fprint(out, prompt)
+	for scanner.Scan() {
+		entry = append(entry, scanner.Bytes()...)
+		entry = append(entry, '\n')
+		if unbalanced(entry) {
+			fmt.Fprint(out, continuationPrompt)
+			continue
+		}
+
+		if len(bytes.TrimSpace(entry)) > 0 {
+			if historyFile != nil {
+				historyFile.Write(entry)
+			}
+			evalEntry(entry, env, out, errOut)
+		}
+		entry = nil
+		fmt.Fprint(out, prompt)
+	}
+	fmt.Fprintln(out)
+}
+
+// unbalanced reports whether source opens more parentheses or braces than
+// it closes, meaning the entry continues on the next line.
+func unbalanced(source []byte) bool {
+	tokenCh := make(chan token.Struct)
+	go tokenize(tokenCh, bytes.NewReader(source))
+	depth := 0
+	for t := range tokenCh {
+		switch t.Type {
+		case token.LEFT_PAREN, token.LEFT_BRACE:
+			depth++
+		case token.RIGHT_PAREN, token.RIGHT_BRACE:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+func evalEntry(source []byte, env *parser.Environment, out, errOut io.Writer) {
+	rep := newReporter("", source)
+	rep.w = errOut
+
+	tokenCh := make(chan token.Struct)
+	stmtCh := make(chan parser.ASTstmt)
+	go tokenize(tokenCh, bytes.NewReader(source))
+	go parser.ParseProgram(tokenCh, stmtCh)
+	program, errs := collectProgram(stmtCh)
+
+	if len(errs) == 0 {
+		execute(program, env, rep)
+		return
+	}
+
+	// a bare expression, with no semicolon, is evaluated and its value
+	// printed, so the REPL works as a calculator
+	expr, ok := parseExpression(source)
+	if !ok {
+		for _, e := range errs {
+			rep.report(e)
+		}
+		return
+	}
+	if errs := parser.Resolve([]parser.ASTstmt{parser.ASTexpression{Expression: expr, Location: expr.Span()}}); len(errs) > 0 {
+		for _, e := range errs {
+			rep.report(e)
+		}
+		return
+	}
+	value, err := expr.Evaluate(env)
+	if err != nil {
+		rep.report(err)
+		return
+	}
+	fmt.Fprintln(out, value)
+}
+
+// parseExpression parses source as exactly one expression.
+func parseExpression(source []byte) (parser.ASTnode, bool) {
+	tokenCh := make(chan token.Struct)
+	parserCh := make(chan parser.ASTnode)
+	go tokenize(tokenCh, bytes.NewReader(source))
+	go parser.Parse(tokenCh, parserCh)
+
+	nodes := []parser.ASTnode{}
+	ok := true
+	for node := range parserCh {
+		if _, isErr := node.(parser.ASTerror); isErr {
+			ok = false
+		}
+		nodes = append(nodes, node)
+	}
+	if !ok || len(nodes) != 1 {
+		return nil, false
+	}
+	return nodes[0], true
+}
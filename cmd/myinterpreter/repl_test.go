@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	input := `var a = 1;
+a + 2
+fun double(x) {
+  return x * 2;
+}
+double(a)
+print "printed";
+-"oops"
+a = a + 1;
+double(a);
+a
+(1 +
+ 2)
+`
+	history := filepath.Join(t.TempDir(), "history")
+
+	var out, errOut strings.Builder
+	runREPL(strings.NewReader(input), &out, &errOut, history)
+
+	expectedOut := "> > 3\n> ... ... > 2\n> printed\n> > > > 2\n> ... 3\n> \n"
+	if out.String() != expectedOut {
+		t.Errorf("output does not match:\n\texpected '%#v'\n\tgot    : '%#v'", expectedOut, out.String())
+	}
+	expectedErr := "Operand must be a number.\n[line 1]\n"
+	if errOut.String() != expectedErr {
+		t.Errorf("errors do not match:\n\texpected '%#v'\n\tgot    : '%#v'", expectedErr, errOut.String())
+	}
+
+	saved, err := os.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != input {
+		t.Errorf("history does not match:\n\texpected '%#v'\n\tgot    : '%#v'", input, string(saved))
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"example.com/cjon/interpreter-starter-go/pkg/diagnostic"
+	"example.com/cjon/interpreter-starter-go/pkg/parser"
+)
+
+// reporter prints errors to stderr. By default it uses the one-line format
+// of the reference implementation, which the test suites compare against.
+// Setting LOX_DIAGNOSTICS=rich renders source snippets with carets
+// instead, colored when stderr is a terminal and NO_COLOR is unset.
+type reporter struct {
+	w        io.Writer
+	rich     bool
+	renderer diagnostic.Renderer
+}
+
+func newReporter(filename string, source []byte) reporter {
+	color := false
+	if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		_, noColor := os.LookupEnv("NO_COLOR")
+		color = !noColor
+	}
+	return reporter{
+		w:        os.Stderr,
+		rich:     richDiagnostics(),
+		renderer: diagnostic.Renderer{Source: source, Filename: filename, Color: color},
+	}
+}
+
+func richDiagnostics() bool {
+	return os.Getenv("LOX_DIAGNOSTICS") == "rich"
+}
+
+func (r reporter) report(err error) {
+	if re, ok := err.(parser.RuntimeError); ok {
+		err = re.Diagnostic()
+	}
+	var d diagnostic.Diagnostic
+	if r.rich && errors.As(err, &d) {
+		r.renderer.Render(r.w, d)
+		return
+	}
+	fmt.Fprintln(r.w, err)
+}
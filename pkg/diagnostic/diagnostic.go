@@ -0,0 +1,96 @@
+package diagnostic
+
+import (
+	"fmt"
+
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+// Kind says which stage of the interpreter found the problem. It decides
+// how the diagnostic is phrased in the book-compatible one-line form.
+type Kind int
+
+const (
+	Lexical Kind = iota
+	Syntax
+	Resolution
+	Runtime
+)
+
+// Code identifies a class of error. Codes are stable: once published they
+// keep their meaning so scripts and editors can match on them.
+type Code string
+
+const (
+	UnexpectedCharacter Code = "L001"
+	UnterminatedString  Code = "L002"
+	ReadFailed          Code = "L003"
+	InvalidEscape       Code = "L004"
+	UnterminatedComment Code = "L005"
+	MalformedNumber     Code = "L006"
+
+	ExpectToken             Code = "P001"
+	ExpectExpression        Code = "P002"
+	InvalidAssignmentTarget Code = "P003"
+	TooManyArguments        Code = "P004"
+	InvalidNumber           Code = "P005"
+
+	OwnInitializer       Code = "R001"
+	DuplicateLocal       Code = "R002"
+	TopLevelReturn       Code = "R003"
+	InitializerReturn    Code = "R004"
+	ThisOutsideClass     Code = "R005"
+	SuperOutsideClass    Code = "R006"
+	SuperWithoutSubclass Code = "R007"
+	InheritFromSelf      Code = "R008"
+
+	OperandType        Code = "E001"
+	UndefinedVariable  Code = "E002"
+	UndefinedProperty  Code = "E003"
+	NotCallable        Code = "E004"
+	ArityMismatch      Code = "E005"
+	NotAnInstance      Code = "E006"
+	SuperclassNotClass Code = "E007"
+	StackOverflow      Code = "E008"
+)
+
+// Diagnostic is a single error report, located by the span of source text
+// it concerns.
+type Diagnostic struct {
+	Kind    Kind
+	Code    Code
+	Message string
+	Span    token.Span
+	// Lexeme is the text of the offending token; AtEnd is set instead when
+	// the problem was found at the end of the input.
+	Lexeme string
+	AtEnd  bool
+}
+
+// At builds a diagnostic against a token, which is how the parser and
+// resolver report problems.
+func At(kind Kind, code Code, t token.Struct, message string) Diagnostic {
+	return Diagnostic{
+		Kind:    kind,
+		Code:    code,
+		Message: message,
+		Span:    t.Span,
+		Lexeme:  t.Lexeme,
+		AtEnd:   t.Type == token.EOF,
+	}
+}
+
+// Error formats the diagnostic the way the reference Lox implementation
+// does, so output stays comparable with the book's test suite.
+func (d Diagnostic) Error() string {
+	switch d.Kind {
+	case Lexical:
+		return fmt.Sprintf("[line %d] Error: %s", d.Span.Line, d.Message)
+	case Runtime:
+		return fmt.Sprintf("%s\n[line %d]", d.Message, d.Span.Line)
+	}
+	if d.AtEnd {
+		return fmt.Sprintf("[line %d] Error at end: %s", d.Span.Line, d.Message)
+	}
+	return fmt.Sprintf("[line %d] Error at '%s': %s", d.Span.Line, d.Lexeme, d.Message)
+}
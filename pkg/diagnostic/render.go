@@ -0,0 +1,91 @@
+package diagnostic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[1;31m"
+	ansiBlue  = "\x1b[1;34m"
+)
+
+// Renderer prints diagnostics with the offending source line and a caret
+// underline beneath the span, in the style of modern compilers:
+//
+//	error[P001]: Expect ';' after value.
+//	 --> script.lox:2:10
+//	  |
+//	2 | print "b"
+//	  |          ^
+type Renderer struct {
+	Source   []byte
+	Filename string
+	Color    bool
+}
+
+func (r Renderer) paint(color, s string) string {
+	if !r.Color {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// Render writes d to w. Without source text (or with a span outside it)
+// only the header and location are printed.
+func (r Renderer) Render(w io.Writer, d Diagnostic) {
+	fmt.Fprintf(w, "%s%s\n", r.paint(ansiRed, "error["+string(d.Code)+"]"), r.paint(ansiBold, ": "+d.Message))
+
+	location := fmt.Sprintf("%d:%d", d.Span.Line, d.Span.Column)
+	if r.Filename != "" {
+		location = r.Filename + ":" + location
+	}
+
+	lineText, ok := r.line(d.Span.Offset)
+	gutter := strings.Repeat(" ", len(strconv.Itoa(d.Span.Line)))
+	fmt.Fprintf(w, "%s%s %s\n", gutter, r.paint(ansiBlue, "-->"), location)
+	if !ok {
+		return
+	}
+
+	// the caret is placed by reproducing the line's leading whitespace and
+	// counting runes, so tabs and multi-byte characters line up
+	column := min(max(d.Span.Column-1, 0), len(lineText))
+	var pad strings.Builder
+	for _, c := range lineText[:column] {
+		if c == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	end := min(column+d.Span.Length, len(lineText))
+	width := max(utf8.RuneCountInString(lineText[column:end]), 1)
+
+	bar := r.paint(ansiBlue, "|")
+	fmt.Fprintf(w, "%s %s\n", gutter, bar)
+	fmt.Fprintf(w, "%s %s %s\n", r.paint(ansiBlue, strconv.Itoa(d.Span.Line)), bar, lineText)
+	fmt.Fprintf(w, "%s %s %s%s\n", gutter, bar, pad.String(), r.paint(ansiRed, strings.Repeat("^", width)))
+}
+
+// line returns the text of the source line containing offset, without its
+// line terminator.
+func (r Renderer) line(offset int) (string, bool) {
+	if r.Source == nil || offset < 0 || offset > len(r.Source) {
+		return "", false
+	}
+	start := bytes.LastIndexByte(r.Source[:offset], '\n') + 1
+	end := bytes.IndexByte(r.Source[offset:], '\n')
+	if end < 0 {
+		end = len(r.Source)
+	} else {
+		end += offset
+	}
+	return strings.TrimSuffix(string(r.Source[start:end]), "\r"), true
+}
@@ -0,0 +1,124 @@
+package diagnostic
+
+import (
+	"strings"
+	"testing"
+
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+type renderTestStruct struct {
+	name       string
+	source     string
+	diagnostic Diagnostic
+	color      bool
+	output     string
+}
+
+var renderTests []renderTestStruct = []renderTestStruct{
+	{
+		name:   "caret under token",
+		source: "var a = 1;\nprint a +;\n",
+		diagnostic: Diagnostic{
+			Kind:    Syntax,
+			Code:    ExpectExpression,
+			Message: "Expect expression.",
+			Span:    token.Span{Line: 2, Column: 10, Offset: 20, Length: 1},
+			Lexeme:  ";",
+		},
+		output: `error[P002]: Expect expression.
+ --> test.lox:2:10
+  |
+2 | print a +;
+  |          ^
+`,
+	},
+	{
+		name:   "underline whole span",
+		source: "print nope;",
+		diagnostic: Diagnostic{
+			Kind:    Runtime,
+			Code:    UndefinedVariable,
+			Message: "Undefined variable 'nope'.",
+			Span:    token.Span{Line: 1, Column: 7, Offset: 6, Length: 4},
+			Lexeme:  "nope",
+		},
+		output: `error[E002]: Undefined variable 'nope'.
+ --> test.lox:1:7
+  |
+1 | print nope;
+  |       ^^^^
+`,
+	},
+	{
+		name:   "tabs and multi-byte characters",
+		source: "\tprint \"é\" + @;",
+		diagnostic: Diagnostic{
+			Kind:    Lexical,
+			Code:    UnexpectedCharacter,
+			Message: "Unexpected character: @",
+			Span:    token.Span{Line: 1, Column: 14, Offset: 13, Length: 1},
+		},
+		output: "error[L001]: Unexpected character: @\n --> test.lox:1:14\n  |\n1 | \tprint \"é\" + @;\n  | \t           ^\n",
+	},
+	{
+		name:   "end of input",
+		source: "print 1",
+		diagnostic: Diagnostic{
+			Kind:    Syntax,
+			Code:    ExpectToken,
+			Message: "Expect ';' after value.",
+			Span:    token.Span{Line: 1, Column: 8, Offset: 7, Length: 0},
+			AtEnd:   true,
+		},
+		output: `error[P001]: Expect ';' after value.
+ --> test.lox:1:8
+  |
+1 | print 1
+  |        ^
+`,
+	},
+	{
+		name:   "color",
+		source: "-x",
+		diagnostic: Diagnostic{
+			Kind:    Runtime,
+			Code:    OperandType,
+			Message: "Operand must be a number.",
+			Span:    token.Span{Line: 1, Column: 1, Offset: 0, Length: 1},
+		},
+		color:  true,
+		output: "\x1b[1;31merror[E001]\x1b[0m\x1b[1m: Operand must be a number.\x1b[0m\n \x1b[1;34m-->\x1b[0m test.lox:1:1\n  \x1b[1;34m|\x1b[0m\n\x1b[1;34m1\x1b[0m \x1b[1;34m|\x1b[0m -x\n  \x1b[1;34m|\x1b[0m \x1b[1;31m^\x1b[0m\n",
+	},
+}
+
+func TestRender(t *testing.T) {
+	for _, test := range renderTests {
+		t.Run(test.name, func(t *testing.T) {
+			var sb strings.Builder
+			r := Renderer{Source: []byte(test.source), Filename: "test.lox", Color: test.color}
+			r.Render(&sb, test.diagnostic)
+			if sb.String() != test.output {
+				t.Errorf("%s: output does not match:\n\texpected '%#v'\n\tgot    : '%#v'\n", test.name, test.output, sb.String())
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		diagnostic Diagnostic
+		expected   string
+	}{
+		{Diagnostic{Kind: Lexical, Message: "Unterminated string.", Span: token.Span{Line: 3}}, "[line 3] Error: Unterminated string."},
+		{Diagnostic{Kind: Syntax, Message: "Expect expression.", Span: token.Span{Line: 1}, Lexeme: ")"}, "[line 1] Error at ')': Expect expression."},
+		{Diagnostic{Kind: Resolution, Message: "Can't return from top-level code.", Span: token.Span{Line: 2}, Lexeme: "return"}, "[line 2] Error at 'return': Can't return from top-level code."},
+		{Diagnostic{Kind: Syntax, Message: "Expect ';' after value.", Span: token.Span{Line: 4}, AtEnd: true}, "[line 4] Error at end: Expect ';' after value."},
+		{Diagnostic{Kind: Runtime, Message: "Operand must be a number.", Span: token.Span{Line: 5}}, "Operand must be a number.\n[line 5]"},
+	}
+	for _, test := range tests {
+		if got := test.diagnostic.Error(); got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, got)
+		}
+	}
+}
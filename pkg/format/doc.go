@@ -0,0 +1,187 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// The formatter lays code out with a small pretty-printing algebra in the
+// style of Wadler's "prettier printer": a document is text plus line
+// breaks that a group either keeps all of or turns all into spaces,
+// depending on whether the group fits in the remaining width.
+type doc interface{}
+
+type text string
+
+// line is a space, or nothing if soft, when its group fits on one line,
+// and a newline otherwise.
+type line struct{ soft bool }
+
+// hardline is always a newline and forces every group around it to break.
+type hardline struct{}
+
+// lineComment is a // comment, which ends the line it is on and so breaks
+// every group around it. After other text it is set off by a space and
+// the next line is indented as a continuation; on a line of its own the
+// next line keeps the indentation.
+type lineComment string
+
+type concat []doc
+
+type nest struct {
+	indent int
+	d      doc
+}
+
+type group struct {
+	d    doc
+	hard bool // contains a hardline, so can never be flat
+}
+
+var (
+	space    = line{}
+	softline = line{soft: true}
+)
+
+func newGroup(d doc) group {
+	return group{d, containsHardline(d)}
+}
+
+func containsHardline(d doc) bool {
+	switch d := d.(type) {
+	case hardline, lineComment:
+		return true
+	case concat:
+		for _, part := range d {
+			if containsHardline(part) {
+				return true
+			}
+		}
+	case nest:
+		return containsHardline(d.d)
+	case group:
+		return d.hard
+	}
+	return false
+}
+
+// command is a document waiting to be printed at an indentation, either
+// flat or broken.
+type command struct {
+	indent int
+	flat   bool
+	d      doc
+}
+
+// render prints d, breaking groups that do not fit in width columns.
+func render(d doc, width int) string {
+	var out []byte
+	col, pendingIndent := 0, 0
+	newline := func(indent int) {
+		// drop trailing spaces; the formatter never ends a line inside a
+		// token, so this cannot touch a string literal
+		for len(out) > 0 && out[len(out)-1] == ' ' {
+			out = out[:len(out)-1]
+		}
+		out = append(out, '\n')
+		col, pendingIndent = 0, indent
+	}
+	write := func(t text) {
+		if t == "" {
+			return
+		}
+		for ; pendingIndent > 0; pendingIndent-- {
+			out = append(out, ' ')
+			col++
+		}
+		out = append(out, t...)
+		if i := strings.LastIndexByte(string(t), '\n'); i >= 0 {
+			col = utf8.RuneCountInString(string(t[i+1:]))
+		} else {
+			col += utf8.RuneCountInString(string(t))
+		}
+	}
+
+	stack := []command{{0, false, d}}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.d.(type) {
+		case text:
+			write(d)
+		case lineComment:
+			next := max(c.indent, pendingIndent)
+			if col > 0 {
+				if out[len(out)-1] != ' ' {
+					write(" ")
+				}
+				next = c.indent + 2*indent
+			}
+			write(text(d))
+			newline(next)
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{c.indent, c.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, command{c.indent + d.indent, c.flat, d.d})
+		case line:
+			if !c.flat {
+				newline(c.indent)
+			} else if !d.soft {
+				out = append(out, ' ')
+				col++
+			}
+		case hardline:
+			newline(c.indent)
+		case group:
+			flat := c.flat || (!d.hard && fits(width-col-pendingIndent, command{c.indent, true, d.d}, stack))
+			stack = append(stack, command{c.indent, flat, d.d})
+		}
+	}
+	return string(out)
+}
+
+// fits reports whether next, followed by the rest of the stack up to the
+// next line break, fits in remaining columns.
+func fits(remaining int, next command, rest []command) bool {
+	pending := []command{next}
+	for remaining >= 0 {
+		if len(pending) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			pending = append(pending, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+		}
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		switch d := c.d.(type) {
+		case text:
+			if i := strings.IndexByte(string(d), '\n'); i >= 0 {
+				return remaining-utf8.RuneCountInString(string(d[:i])) >= 0
+			}
+			remaining -= utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				pending = append(pending, command{c.indent, c.flat, d[i]})
+			}
+		case nest:
+			pending = append(pending, command{c.indent + d.indent, c.flat, d.d})
+		case line:
+			if !c.flat {
+				return true
+			}
+			if !d.soft {
+				remaining--
+			}
+		case hardline:
+			return true
+		case lineComment:
+			return remaining-1-utf8.RuneCountInString(string(d)) >= 0
+		case group:
+			pending = append(pending, command{c.indent, c.flat && !d.hard, d.d})
+		}
+	}
+	return false
+}
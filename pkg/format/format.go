@@ -0,0 +1,319 @@
+// Package format lays Lox source out in one canonical style: two-space
+// indentation, one statement per line, braces on the line that opens them,
+// single spaces around binary operators and after commas, and lines
+// wrapped to a configurable width. Comments are kept, and so is a single
+// blank line wherever the source had one or more.
+package format
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"example.com/cjon/interpreter-starter-go/pkg/parser"
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+	"example.com/cjon/interpreter-starter-go/pkg/tokenizer"
+)
+
+// Options control the layout.
+type Options struct {
+	// Width is the column lines are wrapped at where possible. Zero means
+	// DefaultWidth.
+	Width int
+	// Mode is the lexical mode the source is written in.
+	Mode tokenizer.Mode
+}
+
+const DefaultWidth = 80
+
+// indent is the width of one level of indentation.
+const indent = 2
+
+// Source formats src. Source that does not parse is not formatted; the
+// lexical and syntax errors are returned instead.
+func Source(src []byte, opts Options) ([]byte, []error) {
+	if opts.Width == 0 {
+		opts.Width = DefaultWidth
+	}
+	tokCh := make(chan token.Struct)
+	go tokenizer.TokenizeMode(context.Background(), tokCh, bytes.NewReader(src), opts.Mode|tokenizer.Trivia)
+	tree, errs := parser.ParseCST(tokCh)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	children := tree.Children
+	eof := children[len(children)-1]
+	_, body := statements(children[:len(children)-1], eof, false)
+	out := render(body, opts.Width)
+	if out != "" {
+		out += "\n"
+	}
+	return []byte(out), nil
+}
+
+// statements lays out a list of statements, or of methods, one per line
+// with the comments around them. closing is the token that ends the list,
+// whose leading comments belong at the end of it. When the list follows
+// an opening brace, comments on the brace's line are returned separately
+// as head.
+func statements(items []*parser.CST, closing *parser.CST, opened bool) (head, body concat) {
+	started := false // whether body has anything in it yet
+	comments := func(leading []token.Struct, beforeItem bool) {
+		trailing, own, blank := splitTrivia(leading)
+		for _, c := range trailing {
+			switch {
+			case started:
+				body = append(body, text(" "), text(c.text))
+			case opened:
+				head = append(head, text(" "), text(c.text))
+			default:
+				own = append([]comment{c}, own...)
+			}
+		}
+		for _, c := range own {
+			if started {
+				body = append(body, hardline{})
+				if c.blankBefore {
+					body = append(body, hardline{})
+				}
+			}
+			body = append(body, text(c.text))
+			started = true
+		}
+		if started && beforeItem {
+			body = append(body, hardline{})
+			if blank {
+				body = append(body, hardline{})
+			}
+		}
+	}
+
+	for _, item := range items {
+		first := firstLeaf(item)
+		comments(first.Leading, true)
+		first.Leading = nil
+		body = append(body, statement(item))
+		started = true
+	}
+	comments(closing.Leading, false)
+	closing.Leading = nil
+	return head, body
+}
+
+// comment is a comment on a line of its own.
+type comment struct {
+	text        string
+	blankBefore bool
+}
+
+// splitTrivia sorts the comments before a token into those that trail the
+// previous token on its line and those on lines of their own, and says
+// whether a blank line separates the token from what comes before it.
+func splitTrivia(leading []token.Struct) (trailing, own []comment, blank bool) {
+	newlines := 0
+	for _, t := range leading {
+		switch t.Type {
+		case token.WHITESPACE:
+			newlines += strings.Count(t.Lexeme, "\n")
+		case token.COMMENT, token.DOC_COMMENT:
+			c := comment{strings.TrimRight(t.Lexeme, " \t\r"), newlines > 1}
+			if newlines == 0 && len(own) == 0 {
+				trailing = append(trailing, c)
+			} else {
+				own = append(own, c)
+			}
+			newlines = 0
+		}
+	}
+	return trailing, own, newlines > 1
+}
+
+func firstLeaf(c *parser.CST) *parser.CST {
+	for c.Kind != "token" {
+		c = c.Children[0]
+	}
+	return c
+}
+
+func isToken(c *parser.CST, tt token.Type) bool {
+	return c.Kind == "token" && c.Token.Type == tt
+}
+
+// leaf prints a token inside a statement. Comments before it stay in
+// place; a line comment ends the line it is on.
+func leaf(c *parser.CST) doc {
+	return append(leadingComments(c), text(c.Token.Lexeme))
+}
+
+// leadingComments prints the comments before a token.
+func leadingComments(c *parser.CST) concat {
+	out := concat{}
+	for _, t := range c.Leading {
+		switch t.Type {
+		case token.COMMENT, token.DOC_COMMENT:
+			if strings.HasPrefix(t.Lexeme, "//") {
+				out = append(out, lineComment(strings.TrimRight(t.Lexeme, " \t\r")))
+			} else {
+				out = append(out, text(t.Lexeme), text(" "))
+			}
+		}
+	}
+	return out
+}
+
+func statement(c *parser.CST) doc {
+	ch := c.Children
+	switch c.Kind {
+	case "varDecl":
+		out := concat{leaf(ch[0]), text(" "), leaf(ch[1])}
+		if len(ch) == 5 {
+			out = append(out, text(" "), leaf(ch[2]), text(" "), expression(ch[3]))
+		}
+		return append(out, leaf(ch[len(ch)-1]))
+	case "exprStmt":
+		return concat{expression(ch[0]), leaf(ch[1])}
+	case "printStmt":
+		return concat{leaf(ch[0]), text(" "), expression(ch[1]), leaf(ch[2])}
+	case "returnStmt":
+		if len(ch) == 2 {
+			return concat{leaf(ch[0]), leaf(ch[1])}
+		}
+		return concat{leaf(ch[0]), text(" "), expression(ch[1]), leaf(ch[2])}
+	case "block":
+		return block(ch)
+	case "ifStmt":
+		out := concat{leaf(ch[0]), text(" "), leaf(ch[1]), expression(ch[2]), leaf(ch[3]), body(ch[4])}
+		if len(ch) == 7 {
+			if ch[4].Kind == "block" {
+				out = append(out, text(" "))
+			} else {
+				out = append(out, hardline{})
+			}
+			out = append(out, leaf(ch[5]))
+			if ch[6].Kind == "ifStmt" {
+				out = append(out, text(" "), statement(ch[6]))
+			} else {
+				out = append(out, body(ch[6]))
+			}
+		}
+		return out
+	case "whileStmt":
+		return concat{leaf(ch[0]), text(" "), leaf(ch[1]), expression(ch[2]), leaf(ch[3]), body(ch[4])}
+	case "forStmt":
+		return forStatement(ch)
+	case "funDecl":
+		return concat{leaf(ch[0]), text(" "), function(ch[1:])}
+	case "method":
+		return function(ch)
+	case "classDecl":
+		out := concat{leaf(ch[0]), text(" "), leaf(ch[1])}
+		i := 2
+		if isToken(ch[i], token.LESS) {
+			out = append(out, text(" "), leaf(ch[2]), text(" "), leaf(ch[3]))
+			i = 4
+		}
+		return append(out, text(" "), block(ch[i:]))
+	}
+	return expression(c)
+}
+
+// block lays out "{" statement* "}".
+func block(ch []*parser.CST) doc {
+	open, close := ch[0], ch[len(ch)-1]
+	head, body := statements(ch[1:len(ch)-1], close, true)
+	if len(body) == 0 {
+		if len(head) == 0 {
+			return concat{leaf(open), leaf(close)}
+		}
+		return concat{leaf(open), head, hardline{}, leaf(close)}
+	}
+	return concat{leaf(open), head, nest{indent, concat{hardline{}, body}}, hardline{}, leaf(close)}
+}
+
+// body lays out the statement controlled by an if, while or for: a block
+// stays on the same line, anything else goes on the next one, indented.
+func body(c *parser.CST) doc {
+	if c.Kind == "block" {
+		return concat{text(" "), statement(c)}
+	}
+	return nest{indent, concat{hardline{}, statement(c)}}
+}
+
+// forStatement lays out "for" "(" initializer condition? ";" increment? ")"
+// statement, where the initializer is a declaration, an expression
+// statement or a lone ";".
+func forStatement(ch []*parser.CST) doc {
+	out := concat{leaf(ch[0]), text(" "), leaf(ch[1])}
+	i := 2
+	if isToken(ch[i], token.SEMICOLON) {
+		out = append(out, leaf(ch[i]))
+	} else {
+		out = append(out, statement(ch[i]))
+	}
+	i++
+	if !isToken(ch[i], token.SEMICOLON) {
+		out = append(out, text(" "), expression(ch[i]))
+		i++
+	}
+	out = append(out, leaf(ch[i]))
+	i++
+	if !isToken(ch[i], token.RIGHT_PAREN) {
+		out = append(out, text(" "), expression(ch[i]))
+		i++
+	}
+	return append(out, leaf(ch[i]), body(ch[i+1]))
+}
+
+// function lays out IDENTIFIER "(" parameters? ")" block.
+func function(ch []*parser.CST) doc {
+	close := 2
+	for !isToken(ch[close], token.RIGHT_PAREN) {
+		close++
+	}
+	return concat{leaf(ch[0]), list(ch[1 : close+1]), text(" "), block(ch[close+1:])}
+}
+
+// list lays out a parenthesized, comma separated list: on one line if it
+// fits, otherwise one item per line.
+func list(ch []*parser.CST) doc {
+	open, close := ch[0], ch[len(ch)-1]
+	if len(ch) == 2 {
+		return concat{leaf(open), leaf(close)}
+	}
+	items := concat{softline}
+	for _, c := range ch[1 : len(ch)-1] {
+		if isToken(c, token.COMMA) {
+			items = append(items, leaf(c), space)
+		} else {
+			items = append(items, expression(c))
+		}
+	}
+	return newGroup(concat{leaf(open), nest{indent, items}, softline, leaf(close)})
+}
+
+func expression(c *parser.CST) doc {
+	ch := c.Children
+	switch c.Kind {
+	case "token":
+		return leaf(c)
+	case "assign":
+		return concat{expression(ch[0]), text(" "), leaf(ch[1]), text(" "), expression(ch[2])}
+	case "binary", "logical":
+		// a line comment before the left operand would break the whole
+		// group, so comments there go before it
+		first := firstLeaf(c)
+		before := leadingComments(first)
+		first.Leading = nil
+		return append(before, newGroup(concat{expression(ch[0]), text(" "), leaf(ch[1]), nest{2 * indent, concat{space, expression(ch[2])}}}))
+	case "unary":
+		return concat{leaf(ch[0]), expression(ch[1])}
+	case "call":
+		return concat{expression(ch[0]), list(ch[1:])}
+	case "get", "super":
+		return concat{expression(ch[0]), leaf(ch[1]), leaf(ch[2])}
+	case "group":
+		return concat{leaf(ch[0]), expression(ch[1]), leaf(ch[2])}
+	}
+	return statement(c)
+}
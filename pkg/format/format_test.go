@@ -0,0 +1,187 @@
+package format
+
+import (
+	"testing"
+
+	"example.com/cjon/interpreter-starter-go/pkg/tokenizer"
+)
+
+type testStruct struct {
+	name   string
+	lines  string
+	mode   tokenizer.Mode
+	width  int
+	errors string
+	output string
+}
+
+var tests []testStruct = []testStruct{
+	{
+		name:   "spacing",
+		lines:  `var  x=1+2*-3;print(x)!=nil and !true or x.y;f( a,b ) ;`,
+		output: "var x = 1 + 2 * -3;\nprint (x) != nil and !true or x.y;\nf(a, b);\n",
+	},
+	{
+		name:  "control flow",
+		lines: `if(a)print 1;else if (b) {print 2;} else print 3; while(x)x=x-1; for(var i=0;i<3;i=i+1){print i;} for(;;){}`,
+		output: `if (a)
+  print 1;
+else if (b) {
+  print 2;
+} else
+  print 3;
+while (x)
+  x = x - 1;
+for (var i = 0; i < 3; i = i + 1) {
+  print i;
+}
+for (;;) {}
+`,
+	},
+	{
+		name: "declarations",
+		lines: `class A<B{init(x){this.x=x;} get(){return super.get()+this.x;} empty(){return;}}
+fun add(a,b){return a+b;}`,
+		output: `class A < B {
+  init(x) {
+    this.x = x;
+  }
+  get() {
+    return super.get() + this.x;
+  }
+  empty() {
+    return;
+  }
+}
+fun add(a, b) {
+  return a + b;
+}
+`,
+	},
+	{
+		name: "comments and blank lines",
+		mode: tokenizer.Extended,
+		lines: `
+
+// leading
+
+
+/// Doc.
+fun f() { // on the brace
+  // first
+
+  print 1;   // trailing
+  /* block */ print 2;
+  // last
+}
+print 3; // end
+// tail
+`,
+		output: `// leading
+
+/// Doc.
+fun f() { // on the brace
+  // first
+
+  print 1; // trailing
+  /* block */
+  print 2;
+  // last
+}
+print 3; // end
+// tail
+`,
+	},
+	{
+		name:  "comments inside expressions",
+		lines: "print 1 + // one\n 2;\nf(a, /* b */ b);",
+		mode:  tokenizer.Extended,
+		output: `print 1 +
+    // one
+    2;
+f(a, /* b */ b);
+`,
+	},
+	{
+		name:  "line comment before an operand",
+		lines: "for (var i = 0; // init\n i < 3; i = i + 1) print i;\nprint // value\n  a and b;",
+		output: `for (var i = 0; // init
+    i < 3; i = i + 1)
+  print i;
+print // value
+    a and b;
+`,
+	},
+	{
+		name:  "line comment after other text",
+		lines: "print x\n // c\n ;\nprint (1 // inside\n);\nfun f() {\n  var x = // c\n 1;\n}\nprint x // a\n // b\n ;",
+		output: `print x // c
+    ;
+print (1 // inside
+    );
+fun f() {
+  var x = // c
+      1;
+}
+print x // a
+    // b
+    ;
+`,
+	},
+	{
+		name:  "wrapping",
+		lines: `print someFunction(argumentNumberOne, argumentNumberTwo) + anotherValue * 2;`,
+		width: 40,
+		output: `print someFunction(
+  argumentNumberOne,
+  argumentNumberTwo
+) +
+    anotherValue * 2;
+`,
+	},
+	{
+		name:   "wrapping a long chain",
+		lines:  `var total = first + second + third + fourth;`,
+		width:  30,
+		output: "var total = first + second +\n    third +\n    fourth;\n",
+	},
+	{
+		name:   "tokens are kept as written",
+		lines:  "print 0xff_1 + 1.50 + \"a\\tb\" ;",
+		mode:   tokenizer.Extended,
+		output: "print 0xff_1 + 1.50 + \"a\\tb\";\n",
+	},
+	{
+		name:   "syntax errors",
+		lines:  "print 1 +;\nvar @;",
+		errors: "[line 1] Error at ';': Expect expression.\n[line 2] Error: Unexpected character: @\n[line 2] Error at ';': Expect variable name.\n",
+	},
+	{
+		name:   "empty",
+		lines:  "",
+		output: "",
+	},
+}
+
+func TestSource(t *testing.T) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := Options{Width: test.width, Mode: test.mode}
+			output, errs := Source([]byte(test.lines), opts)
+			got := ""
+			for _, err := range errs {
+				got += err.Error() + "\n"
+			}
+			if got != test.errors {
+				t.Errorf("errors do not match:\n\texpected %q\n\tgot      %q", test.errors, got)
+			}
+			if string(output) != test.output {
+				t.Errorf("output does not match:\n\texpected %q\n\tgot      %q", test.output, output)
+			}
+			again, _ := Source(output, opts)
+			if string(again) != string(output) {
+				t.Errorf("formatting is not idempotent:\n\tfirst  %q\n\tsecond %q", output, again)
+			}
+		})
+	}
+}
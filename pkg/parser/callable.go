@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"fmt"
+	"time"
+
+	"example.com/cjon/interpreter-starter-go/pkg/diagnostic"
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+// Callable is a value that can be invoked with "()": native functions,
+// user-defined functions and, later, classes all dispatch through it.
+type Callable interface {
+	Value
+	Arity() int
+	Call(args []Value) (Value, error)
+}
+
+// NativeFunction is a Callable implemented in Go.
+type NativeFunction struct {
+	arity int
+	fn    func(args []Value) (Value, error)
+}
+
+func (n *NativeFunction) String() string {
+	return "<native fn>"
+}
+
+func (n *NativeFunction) Arity() int {
+	return n.arity
+}
+
+func (n *NativeFunction) Call(args []Value) (Value, error) {
+	return n.fn(args)
+}
+
+// Function is a user-defined function together with the environment it
+// was declared in, which makes it a closure.
+type Function struct {
+	declaration   ASTfunction
+	closure       *Environment
+	isInitializer bool
+}
+
+// bind returns a copy of a method whose closure defines "this" as
+// instance.
+func (f *Function) bind(instance *Instance) *Function {
+	env := NewEnvironment(f.closure)
+	env.Define("this", instance)
+	return &Function{declaration: f.declaration, closure: env, isInitializer: f.isInitializer}
+}
+
+func (f *Function) String() string {
+	return fmt.Sprintf("<fn %s>", f.declaration.Name.Lexeme)
+}
+
+func (f *Function) Arity() int {
+	return len(f.declaration.Params)
+}
+
+func (f *Function) Call(args []Value) (Value, error) {
+	env := NewEnvironment(f.closure)
+	for i, param := range f.declaration.Params {
+		env.Define(param.Lexeme, args[i])
+	}
+
+	err := executeBlock(f.declaration.Body, env)
+	if _, ok := err.(returnValue); ok && f.isInitializer {
+		// the resolver only lets initializers use a bare "return;"
+		return f.closure.GetAt(0, thisToken)
+	}
+	if r, ok := err.(returnValue); ok {
+		return r.value, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.isInitializer {
+		return f.closure.GetAt(0, thisToken)
+	}
+	return NilValue{}, nil
+}
+
+// thisToken names the "this" binding that bind adds to method closures.
+var thisToken = token.Struct{Type: token.THIS, Lexeme: "this"}
+
+// Class is both the runtime representation of a class declaration and the
+// callable that constructs its instances.
+type Class struct {
+	name       string
+	superclass *Class
+	methods    map[string]*Function
+}
+
+func (c *Class) String() string {
+	return c.name
+}
+
+// findMethod looks name up on the class and then up its superclass chain.
+func (c *Class) findMethod(name string) (*Function, bool) {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.methods[name]; ok {
+			return method, true
+		}
+	}
+	return nil, false
+}
+
+func (c *Class) Arity() int {
+	if initializer, ok := c.findMethod("init"); ok {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+func (c *Class) Call(args []Value) (Value, error) {
+	instance := &Instance{class: c, fields: map[string]Value{}}
+	if initializer, ok := c.findMethod("init"); ok {
+		if _, err := initializer.bind(instance).Call(args); err != nil {
+			return nil, err
+		}
+	}
+	return instance, nil
+}
+
+type Instance struct {
+	class  *Class
+	fields map[string]Value
+}
+
+func (i *Instance) String() string {
+	return i.class.name + " instance"
+}
+
+// Get looks up a property, preferring fields over methods so that a field
+// can shadow a method of the same name.
+func (i *Instance) Get(name token.Struct) (Value, error) {
+	if value, ok := i.fields[name.Lexeme]; ok {
+		return value, nil
+	}
+	if method, ok := i.class.findMethod(name.Lexeme); ok {
+		return method.bind(i), nil
+	}
+	return nil, RuntimeError{name, diagnostic.UndefinedProperty, fmt.Sprintf("Undefined property '%s'.", name.Lexeme)}
+}
+
+func (i *Instance) Set(name token.Struct, value Value) {
+	i.fields[name.Lexeme] = value
+}
+
+// NewGlobalEnvironment returns a top-level environment with the native
+// functions already defined.
+func NewGlobalEnvironment() *Environment {
+	globals := NewEnvironment(nil)
+	globals.Define("clock", &NativeFunction{
+		arity: 0,
+		fn: func(args []Value) (Value, error) {
+			return NumberValue(float64(time.Now().UnixNano()) / float64(time.Second)), nil
+		},
+	})
+	return globals
+}
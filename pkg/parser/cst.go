@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"context"
+	"strings"
+
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+// CST is a node of the concrete syntax tree built by ParseCST. A leaf, of
+// Kind "token", holds one token together with everything the parser
+// skipped just before it: whitespace, comments, doc comments and ERROR
+// tokens. Any other node groups the nodes of one grammar rule, and its
+// Kind names the rule: "classDecl", "method", "funDecl", "varDecl",
+// "exprStmt", "forStmt", "ifStmt", "printStmt", "returnStmt", "whileStmt",
+// "block", "assign", "logical", "binary", "unary", "call", "get", "group",
+// "super", or "error" for a declaration that failed to parse, which may
+// sit inside a block. The root is "program".
+type CST struct {
+	Kind     string
+	Token    token.Struct
+	Leading  []token.Struct
+	Children []*CST
+}
+
+// String reprints the source the node was parsed from.
+func (c *CST) String() string {
+	var sb strings.Builder
+	c.write(&sb)
+	return sb.String()
+}
+
+func (c *CST) write(sb *strings.Builder) {
+	for _, t := range c.Leading {
+		sb.WriteString(t.Lexeme)
+	}
+	if c.Kind == "token" {
+		sb.WriteString(c.Token.Lexeme)
+	}
+	for _, child := range c.Children {
+		child.write(sb)
+	}
+}
+
+// ParseCST parses a full program into a concrete syntax tree. Given tokens
+// scanned in tokenizer.Trivia mode the tree holds every byte of the
+// source, so printing it reproduces the input exactly. Lexical and syntax
+// errors are returned alongside the tree rather than in it.
+func ParseCST(tokens <-chan token.Struct) (*CST, []error) {
+	p := parser{lts: lookaheadTokenStream{ctx: context.Background(), ch: tokens, tree: &cstBuilder{}}}
+	for p.lts.peek().Type != token.EOF {
+		p.declaration()
+	}
+	errs := p.takeErrors()
+	p.lts.tree.leaf(*p.lts.peek(), p.lts.leading)
+	return &CST{Kind: "program", Children: p.lts.tree.nodes}, errs
+}
+
+// cstBuilder collects the tree bottom up: tokens are appended as leaves as
+// the parser consumes them, and once a rule has been parsed the nodes
+// produced since it started are folded into one.
+type cstBuilder struct {
+	nodes []*CST
+}
+
+func (b *cstBuilder) leaf(t token.Struct, leading []token.Struct) {
+	b.nodes = append(b.nodes, &CST{Kind: "token", Token: t, Leading: leading})
+}
+
+// mark remembers where a rule starts, for wrap.
+func (p *parser) mark() int {
+	if p.lts.tree == nil {
+		return 0
+	}
+	return len(p.lts.tree.nodes)
+}
+
+// wrap folds the nodes produced since m into a node of the given kind,
+// unless err says the rule failed. It returns err, so that callers can
+// pass their result straight through.
+func (p *parser) wrap(m int, kind string, err error) error {
+	if err != nil || p.lts.tree == nil || m == len(p.lts.tree.nodes) {
+		return err
+	}
+	b := p.lts.tree
+	children := append([]*CST(nil), b.nodes[m:]...)
+	b.nodes = append(b.nodes[:m], &CST{Kind: kind, Children: children})
+	return nil
+}
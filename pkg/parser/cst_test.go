@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+	"example.com/cjon/interpreter-starter-go/pkg/tokenizer"
+)
+
+func parseCST(lines string, mode tokenizer.Mode) (*CST, []error) {
+	tokCh := make(chan token.Struct)
+	go tokenizer.TokenizeMode(context.Background(), tokCh, strings.NewReader(lines), mode|tokenizer.Trivia)
+	return ParseCST(tokCh)
+}
+
+// shape prints the rule structure of a tree, leaving out leaves.
+func shape(c *CST) string {
+	if c.Kind == "token" {
+		return c.Token.Lexeme
+	}
+	parts := []string{c.Kind}
+	for _, child := range c.Children {
+		parts = append(parts, shape(child))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func TestCSTIsLossless(t *testing.T) {
+	sources := []string{
+		"/// doc\nclass A < B {\n  // c\n  m(a, b) { return super.m(a)  ; }\n}\n\t\n",
+		"for (var i = 0; i < 3; i = i + 1) /* nested /* block */ */ print i;\n// trailing",
+		"var s = \"one\ntwo\" ;  1 @ 2; \"unterminated",
+		"print (1 +;\nprint 0x_ff; var 1 = 2; fun (",
+	}
+	for _, tests := range [][]evalTestStruct{evalTests, parseTests, runTests} {
+		for _, test := range tests {
+			sources = append(sources, test.lines)
+		}
+	}
+	for _, source := range sources {
+		for _, mode := range []tokenizer.Mode{0, tokenizer.Extended | tokenizer.DocComments} {
+			tree, _ := parseCST(source, mode)
+			if got := tree.String(); got != source {
+				t.Errorf("mode %d: reprinted %q as %q", mode, source, got)
+			}
+		}
+	}
+}
+
+func TestCSTShape(t *testing.T) {
+	tree, errs := parseCST(`var x = -1 + 2 * f(3).y; // hi
+if (x) { x = (x); } else print x or nil;
+print ;
+`, 0)
+	if len(errs) != 1 || errs[0].Error() != "[line 3] Error at ';': Expect expression." {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	expected := "(program (varDecl var x = (binary (unary - 1) + (binary 2 * (get (call f ( 3 )) . y))) ;)" +
+		" (ifStmt if ( x ) (block { (exprStmt (assign x = (group ( x ))) ;) }) else (printStmt print (logical x or nil) ;))" +
+		" (error print ;) )"
+	if got := shape(tree); got != expected {
+		t.Errorf("expected\n\t%s\ngot\n\t%s", expected, got)
+	}
+}
+
+func TestCSTShapeNestedError(t *testing.T) {
+	tree, errs := parseCST("fun f() { var = 1; print 2; }\n", 0)
+	if len(errs) != 1 || errs[0].Error() != "[line 1] Error at '=': Expect variable name." {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	expected := "(program (funDecl fun f ( ) { (error var = 1 ;) (printStmt print 2 ;) }) )"
+	if got := shape(tree); got != expected {
+		t.Errorf("expected\n\t%s\ngot\n\t%s", expected, got)
+	}
+}
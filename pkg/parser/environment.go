@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"example.com/cjon/interpreter-starter-go/pkg/diagnostic"
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+// Environment holds the variables of one scope and links to the scope
+// that lexically encloses it; the globals have no enclosing scope.
+type Environment struct {
+	values    map[string]Value
+	enclosing *Environment
+
+	// only kept on the globals
+	out   io.Writer // where print writes
+	depth int       // calls in progress
+}
+
+// NewEnvironment returns an empty scope inside enclosing. A new globals
+// environment, with no enclosing scope, prints to standard output.
+func NewEnvironment(enclosing *Environment) *Environment {
+	env := &Environment{values: map[string]Value{}, enclosing: enclosing}
+	if enclosing == nil {
+		env.out = os.Stdout
+	}
+	return env
+}
+
+// Define binds name in this scope, silently replacing any previous binding.
+func (e *Environment) Define(name string, value Value) {
+	e.values[name] = value
+}
+
+func (e *Environment) Get(name token.Struct) (Value, error) {
+	for env := e; env != nil; env = env.enclosing {
+		if value, ok := env.values[name.Lexeme]; ok {
+			return value, nil
+		}
+	}
+	return nil, undefinedVariable(name)
+}
+
+// Assign rebinds an existing variable in the nearest scope that defines it.
+func (e *Environment) Assign(name token.Struct, value Value) error {
+	for env := e; env != nil; env = env.enclosing {
+		if _, ok := env.values[name.Lexeme]; ok {
+			env.values[name.Lexeme] = value
+			return nil
+		}
+	}
+	return undefinedVariable(name)
+}
+
+// Globals returns the outermost environment of the chain.
+func (e *Environment) Globals() *Environment {
+	env := e
+	for env.enclosing != nil {
+		env = env.enclosing
+	}
+	return env
+}
+
+// SetOutput directs the output of print statements run anywhere in this
+// environment's chain to w.
+func (e *Environment) SetOutput(w io.Writer) {
+	e.Globals().out = w
+}
+
+func (e *Environment) ancestor(distance int) *Environment {
+	env := e
+	for i := 0; i < distance; i++ {
+		env = env.enclosing
+	}
+	return env
+}
+
+// GetAt reads a variable the resolver found exactly distance scopes out.
+func (e *Environment) GetAt(distance int, name token.Struct) (Value, error) {
+	value, ok := e.ancestor(distance).values[name.Lexeme]
+	if !ok {
+		return nil, undefinedVariable(name)
+	}
+	return value, nil
+}
+
+// AssignAt rebinds a variable the resolver found exactly distance scopes out.
+func (e *Environment) AssignAt(distance int, name token.Struct, value Value) error {
+	env := e.ancestor(distance)
+	if _, ok := env.values[name.Lexeme]; !ok {
+		return undefinedVariable(name)
+	}
+	env.values[name.Lexeme] = value
+	return nil
+}
+
+func undefinedVariable(name token.Struct) error {
+	return RuntimeError{name, diagnostic.UndefinedVariable, fmt.Sprintf("Undefined variable '%s'.", name.Lexeme)}
+}
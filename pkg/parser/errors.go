@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"example.com/cjon/interpreter-starter-go/pkg/diagnostic"
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+// RuntimeError is raised while evaluating a well-formed program, e.g. when
+// an operator is applied to operands of the wrong type. Token is the
+// operator (or name) the error is reported against.
+type RuntimeError struct {
+	Token   token.Struct
+	Code    diagnostic.Code
+	Message string
+}
+
+func (e RuntimeError) Error() string {
+	return e.Diagnostic().Error()
+}
+
+func (e RuntimeError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.At(diagnostic.Runtime, e.Code, e.Token, e.Message)
+}
+
+// returnValue unwinds the Go stack from a return statement back to the
+// Function.Call that is executing it. It is never seen outside a call.
+type returnValue struct {
+	value Value
+}
+
+func (r returnValue) Error() string {
+	return "return outside of function"
+}
@@ -1,15 +1,21 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
+	"example.com/cjon/interpreter-starter-go/pkg/diagnostic"
 	"example.com/cjon/interpreter-starter-go/pkg/token"
 )
 
 type ASTnode interface {
-	fmt.Stringer
-	Evaluate() string
+	Node
+	Evaluate(env *Environment) (Value, error)
+	// Span covers all of the source text the expression was parsed from.
+	Span() token.Span
 }
 
 type ASTerror struct {
@@ -20,41 +26,313 @@ func (e ASTerror) String() string {
 	return e.err.Error()
 }
 
-func (e ASTerror) Evaluate() string {
-	return e.err.Error()
+func (e ASTerror) Evaluate(env *Environment) (Value, error) {
+	return nil, e.err
+}
+
+func (e ASTerror) Span() token.Span {
+	var d diagnostic.Diagnostic
+	if errors.As(e.err, &d) {
+		return d.Span
+	}
+	return token.Span{}
+}
+
+// Err returns the error the node stands in for.
+func (e ASTerror) Err() error {
+	return e.err
 }
 
 type ASTgroup struct {
 	Contents ASTnode
+	Location token.Span
 }
 
 func (g ASTgroup) String() string {
 	return fmt.Sprintf("(group %s)", g.Contents)
 }
 
-func (g ASTgroup) Evaluate() string {
-	return ""
+func (g ASTgroup) Evaluate(env *Environment) (Value, error) {
+	return g.Contents.Evaluate(env)
+}
+
+func (g ASTgroup) Span() token.Span {
+	return g.Location
 }
 
 type ASTliteral struct {
 	Contents string
+	Value    Value
+	Location token.Span
 }
 
 func (l ASTliteral) String() string {
 	return l.Contents
 }
 
-func (l ASTliteral) Evaluate() string {
-	return l.Contents
+func (l ASTliteral) Evaluate(env *Environment) (Value, error) {
+	return l.Value, nil
+}
+
+func (l ASTliteral) Span() token.Span {
+	return l.Location
+}
+
+// ASTvariable reads a variable. Both it and ASTassign are only ever used
+// through pointers so the resolver can record which scope they refer to.
+type ASTvariable struct {
+	Name token.Struct
+	binding
+}
+
+func (v *ASTvariable) String() string {
+	return v.Name.Lexeme
+}
+
+func (v *ASTvariable) Evaluate(env *Environment) (Value, error) {
+	if v.local {
+		return env.GetAt(v.depth, v.Name)
+	}
+	return env.Globals().Get(v.Name)
+}
+
+func (v *ASTvariable) Span() token.Span {
+	return v.Name.Span
+}
+
+type ASTassign struct {
+	Name  token.Struct
+	Value ASTnode
+	binding
+}
+
+func (a *ASTassign) String() string {
+	return fmt.Sprintf("(= %s %s)", a.Name.Lexeme, a.Value)
+}
+
+func (a *ASTassign) Evaluate(env *Environment) (Value, error) {
+	value, err := a.Value.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	if a.local {
+		err = env.AssignAt(a.depth, a.Name, value)
+	} else {
+		err = env.Globals().Assign(a.Name, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (a *ASTassign) Span() token.Span {
+	return a.Name.Span.Join(a.Value.Span())
+}
+
+// ASTlogical is an "and" or "or" expression. Unlike ASTbinary the right
+// operand is only evaluated when the left one doesn't decide the result.
+type ASTlogical struct {
+	Operator token.Struct
+	Left     ASTnode
+	Right    ASTnode
+}
+
+func (l ASTlogical) String() string {
+	return fmt.Sprintf("(%s %s %s)", l.Operator.Lexeme, l.Left, l.Right)
+}
+
+func (l ASTlogical) Evaluate(env *Environment) (Value, error) {
+	left, err := l.Left.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Operator.Type == token.OR {
+		if IsTruthy(left) {
+			return left, nil
+		}
+	} else if !IsTruthy(left) {
+		return left, nil
+	}
+	return l.Right.Evaluate(env)
+}
+
+func (l ASTlogical) Span() token.Span {
+	return l.Left.Span().Join(l.Right.Span())
+}
+
+type ASTcall struct {
+	Callee    ASTnode
+	Paren     token.Struct
+	Arguments []ASTnode
+}
+
+func (c ASTcall) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "(call %s", c.Callee)
+	for _, arg := range c.Arguments {
+		sb.WriteString(" ")
+		sb.WriteString(arg.String())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// maxCallDepth bounds how deeply Lox calls may nest, so that runaway
+// recursion is a runtime error rather than an overflow of the Go stack.
+const maxCallDepth = 10000
+
+func (c ASTcall) Evaluate(env *Environment) (Value, error) {
+	callee, err := c.Callee.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]Value, 0, len(c.Arguments))
+	for _, arg := range c.Arguments {
+		value, err := arg.Evaluate(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	function, ok := callee.(Callable)
+	if !ok {
+		return nil, RuntimeError{c.Paren, diagnostic.NotCallable, "Can only call functions and classes."}
+	}
+	if len(args) != function.Arity() {
+		return nil, RuntimeError{c.Paren, diagnostic.ArityMismatch, fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(args))}
+	}
+	globals := env.Globals()
+	if globals.depth >= maxCallDepth {
+		return nil, RuntimeError{c.Paren, diagnostic.StackOverflow, "Stack overflow."}
+	}
+	globals.depth++
+	defer func() { globals.depth-- }()
+	return function.Call(args)
+}
+
+func (c ASTcall) Span() token.Span {
+	return c.Callee.Span().Join(c.Paren.Span)
+}
+
+type ASTget struct {
+	Object ASTnode
+	Name   token.Struct
+}
+
+func (g ASTget) String() string {
+	return fmt.Sprintf("(. %s %s)", g.Object, g.Name.Lexeme)
+}
+
+func (g ASTget) Evaluate(env *Environment) (Value, error) {
+	object, err := g.Object.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	instance, ok := object.(*Instance)
+	if !ok {
+		return nil, RuntimeError{g.Name, diagnostic.NotAnInstance, "Only instances have properties."}
+	}
+	return instance.Get(g.Name)
+}
+
+func (g ASTget) Span() token.Span {
+	return g.Object.Span().Join(g.Name.Span)
+}
+
+type ASTset struct {
+	Object ASTnode
+	Name   token.Struct
+	Value  ASTnode
+}
+
+func (s ASTset) String() string {
+	return fmt.Sprintf("(= (. %s %s) %s)", s.Object, s.Name.Lexeme, s.Value)
+}
+
+func (s ASTset) Evaluate(env *Environment) (Value, error) {
+	object, err := s.Object.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	instance, ok := object.(*Instance)
+	if !ok {
+		return nil, RuntimeError{s.Name, diagnostic.NotAnInstance, "Only instances have fields."}
+	}
+	value, err := s.Value.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	instance.Set(s.Name, value)
+	return value, nil
+}
+
+func (s ASTset) Span() token.Span {
+	return s.Object.Span().Join(s.Value.Span())
+}
+
+type ASTthis struct {
+	Keyword token.Struct
+	binding
+}
+
+func (t *ASTthis) String() string {
+	return "this"
+}
+
+func (t *ASTthis) Evaluate(env *Environment) (Value, error) {
+	return env.GetAt(t.depth, t.Keyword)
+}
+
+func (t *ASTthis) Span() token.Span {
+	return t.Keyword.Span
+}
+
+type ASTsuper struct {
+	Keyword token.Struct
+	Method  token.Struct
+	binding
+}
+
+func (s *ASTsuper) String() string {
+	return fmt.Sprintf("(super %s)", s.Method.Lexeme)
+}
+
+func (s *ASTsuper) Evaluate(env *Environment) (Value, error) {
+	value, err := env.GetAt(s.depth, s.Keyword)
+	if err != nil {
+		return nil, err
+	}
+	superclass := value.(*Class)
+
+	// "this" always lives in the scope just inside the one holding "super"
+	value, err = env.GetAt(s.depth-1, thisToken)
+	if err != nil {
+		return nil, err
+	}
+	instance := value.(*Instance)
+
+	method, ok := superclass.findMethod(s.Method.Lexeme)
+	if !ok {
+		return nil, RuntimeError{s.Method, diagnostic.UndefinedProperty, fmt.Sprintf("Undefined property '%s'.", s.Method.Lexeme)}
+	}
+	return method.bind(instance), nil
+}
+
+func (s *ASTsuper) Span() token.Span {
+	return s.Keyword.Span.Join(s.Method.Span)
 }
 
 type ASTunary struct {
-	Operator token.Type
+	Operator token.Struct
 	Contents ASTnode
 }
 
 func (l ASTunary) String() string {
-	switch l.Operator {
+	switch l.Operator.Type {
 	case token.BANG:
 		str := fmt.Sprintf("(! %s)", l.Contents)
 		return str
@@ -66,19 +344,38 @@ func (l ASTunary) String() string {
 	}
 }
 
-func (l ASTunary) Evaluate() string {
-	return ""
+func (l ASTunary) Evaluate(env *Environment) (Value, error) {
+	right, err := l.Contents.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	switch l.Operator.Type {
+	case token.BANG:
+		return BoolValue(!IsTruthy(right)), nil
+	case token.MINUS:
+		n, ok := right.(NumberValue)
+		if !ok {
+			return nil, RuntimeError{l.Operator, diagnostic.OperandType, "Operand must be a number."}
+		}
+		return -n, nil
+	default:
+		return right, nil
+	}
+}
+
+func (l ASTunary) Span() token.Span {
+	return l.Operator.Span.Join(l.Contents.Span())
 }
 
 type ASTbinary struct {
-	Operator token.Type
+	Operator token.Struct
 	Left     ASTnode
 	Right    ASTnode
 }
 
 func (b ASTbinary) String() string {
 	var str string
-	switch b.Operator {
+	switch b.Operator.Type {
 	case token.SLASH:
 		str = fmt.Sprintf("(/ %s %s)", b.Left, b.Right)
 	case token.STAR:
@@ -105,19 +402,116 @@ func (b ASTbinary) String() string {
 	return str
 }
 
-func (b ASTbinary) Evaluate() string {
-	return ""
+func (b ASTbinary) Evaluate(env *Environment) (Value, error) {
+	left, err := b.Left.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := b.Right.Evaluate(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch b.Operator.Type {
+	case token.EQUAL_EQUAL:
+		return BoolValue(IsEqual(left, right)), nil
+	case token.BANG_EQUAL:
+		return BoolValue(!IsEqual(left, right)), nil
+	case token.PLUS:
+		ls, lok := left.(StringValue)
+		rs, rok := right.(StringValue)
+		if lok && rok {
+			return ls + rs, nil
+		}
+		ln, lok := left.(NumberValue)
+		rn, rok := right.(NumberValue)
+		if lok && rok {
+			return ln + rn, nil
+		}
+		return nil, RuntimeError{b.Operator, diagnostic.OperandType, "Operands must be two numbers or two strings."}
+	}
+
+	ln, lok := left.(NumberValue)
+	rn, rok := right.(NumberValue)
+	if !lok || !rok {
+		return nil, RuntimeError{b.Operator, diagnostic.OperandType, "Operands must be numbers."}
+	}
+	switch b.Operator.Type {
+	case token.MINUS:
+		return ln - rn, nil
+	case token.STAR:
+		return ln * rn, nil
+	case token.SLASH:
+		return ln / rn, nil
+	case token.GREATER:
+		return BoolValue(ln > rn), nil
+	case token.GREATER_EQUAL:
+		return BoolValue(ln >= rn), nil
+	case token.LESS:
+		return BoolValue(ln < rn), nil
+	case token.LESS_EQUAL:
+		return BoolValue(ln <= rn), nil
+	default:
+		return nil, RuntimeError{b.Operator, diagnostic.OperandType, fmt.Sprintf("Unknown binary operator '%s'.", b.Operator.Lexeme)}
+	}
+}
+
+func (b ASTbinary) Span() token.Span {
+	return b.Left.Span().Join(b.Right.Span())
 }
 
+// lookaheadTokenStream gives the parser one token of lookahead. ERROR
+// tokens from the tokenizer are set aside as they are read so the grammar
+// never has to deal with them.
 type lookaheadTokenStream struct {
-	ch   <-chan token.Struct
-	curr *token.Struct
+	ctx       context.Context
+	ch        <-chan token.Struct
+	curr      *token.Struct
+	prev      *token.Struct
+	lexErrors []error
+	docs      []token.Struct // DOC_COMMENT tokens just before curr
+	leading   []token.Struct // every token skipped just before curr
+	tree      *cstBuilder    // nil unless a concrete syntax tree is wanted
+}
+
+// next receives the next token that is not an ERROR, trivia or a
+// DOC_COMMENT.
+// Cancellation or a closed channel look like the end of input, so the
+// parser unwinds as it would at EOF.
+func (lts *lookaheadTokenStream) next() *token.Struct {
+	lts.docs, lts.leading = nil, nil
+	for {
+		var t token.Struct
+		var ok bool
+		select {
+		case t, ok = <-lts.ch:
+		case <-lts.ctx.Done():
+		}
+		if !ok {
+			t = token.Struct{Type: token.EOF}
+			if lts.prev != nil {
+				t.Span = token.Span{Line: lts.prev.Line, Column: lts.prev.Column + lts.prev.Length, Offset: lts.prev.End()}
+			}
+			return &t
+		}
+		switch t.Type {
+		case token.ERROR:
+			lts.lexErrors = append(lts.lexErrors, t.Err)
+		case token.DOC_COMMENT:
+			lts.docs = append(lts.docs, t)
+		case token.WHITESPACE, token.COMMENT:
+		default:
+			return &t
+		}
+		if lts.tree != nil {
+			lts.leading = append(lts.leading, t)
+		}
+	}
 }
 
 func (lts *lookaheadTokenStream) peek() *token.Struct {
 	if lts.curr == nil {
-		t := <-lts.ch
-		lts.curr = &t
+		lts.curr = lts.next()
 	}
 	return lts.curr
 }
@@ -125,230 +519,873 @@ func (lts *lookaheadTokenStream) peek() *token.Struct {
 func (lts *lookaheadTokenStream) consume() *token.Struct {
 	r := lts.peek()
 	if lts.curr.Type != token.EOF {
-		t := <-lts.ch
-		lts.curr = &t
+		if lts.tree != nil {
+			lts.tree.leaf(*r, lts.leading)
+		}
+		lts.curr = lts.next()
 	}
+	lts.prev = r
 	return r
 }
 
+// previous returns the most recently consumed token, or nil if nothing
+// has been consumed yet.
+func (lts *lookaheadTokenStream) previous() *token.Struct {
+	return lts.prev
+}
+
+// doc returns the doc comments written directly before the token that
+// peek returns.
+func (lts *lookaheadTokenStream) doc() []token.Struct {
+	lts.peek()
+	return lts.docs
+}
+
+// takeErrors returns the tokenizer errors seen since the last call.
+func (lts *lookaheadTokenStream) takeErrors() []error {
+	errs := lts.lexErrors
+	lts.lexErrors = nil
+	return errs
+}
+
+// maxArguments caps both parameter lists and argument lists.
+const maxArguments = 255
+
+type parser struct {
+	lts    lookaheadTokenStream
+	errors []error // syntax errors recovered from, with the lexical errors before them
+}
+
+// Parse reads a stream of bare expressions, as used by the parse and
+// evaluate commands. Errors are sent as ASTerror nodes; after each one the
+// parser skips ahead to a likely statement boundary before carrying on.
 func Parse(tokens <-chan token.Struct, astNodes chan<- ASTnode) {
-	var group func() (ASTnode, error)
-	var primary func() (ASTnode, error)
-	var expression func() (ASTnode, error)
-	var equality func() (ASTnode, error)
-	var comparison func() (ASTnode, error)
-	var term func() (ASTnode, error)
-	var factor func() (ASTnode, error)
-	var unary func() (ASTnode, error)
-	lts := lookaheadTokenStream{ch: tokens}
-
-	// expression     → equality ;
-	expression = func() (ASTnode, error) {
-		expr, err := equality()
-		return expr, err
+	ParseContext(context.Background(), tokens, astNodes)
+}
+
+// ParseContext is Parse that gives up once ctx is done, so a consumer that
+// stops reading early can cancel ctx rather than leave the parser blocked
+// forever. astNodes is closed either way. It returns nil once the input is
+// exhausted, or the cause of the cancellation. Pass the same ctx to
+// tokenizer.TokenizeContext so that the tokenizer stops as well.
+func ParseContext(ctx context.Context, tokens <-chan token.Struct, astNodes chan<- ASTnode) error {
+	p := parser{lts: lookaheadTokenStream{ctx: ctx, ch: tokens}}
+	return parseEach(ctx, &p, p.expression, astNodes)
+}
+
+// ParseProgram reads a full Lox program, one declaration at a time. Each
+// syntax error is sent as an ASTerror, after which the parser synchronizes
+// on the next statement boundary so that independent errors are all
+// reported without cascading.
+//
+// program        → declaration* EOF ;
+func ParseProgram(tokens <-chan token.Struct, stmts chan<- ASTstmt) {
+	ParseProgramContext(context.Background(), tokens, stmts)
+}
+
+// ParseProgramContext is ParseProgram that gives up once ctx is done, in
+// the same way as ParseContext.
+func ParseProgramContext(ctx context.Context, tokens <-chan token.Struct, stmts chan<- ASTstmt) error {
+	p := parser{lts: lookaheadTokenStream{ctx: ctx, ch: tokens}}
+	return parseEach(ctx, &p, func() (ASTstmt, error) { return p.declaration(), nil }, stmts)
+}
+
+// parseEach calls parse until the input runs out, sending each result to
+// out with any errors met along the way. A nil result stands for a
+// declaration that failed and has already been recovered from. T is
+// ASTnode or ASTstmt, both of which ASTerror implements.
+func parseEach[T any](ctx context.Context, p *parser, parse func() (T, error), out chan<- T) error {
+	defer close(out)
+	send := func(v T) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		select {
+		case out <- v:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	sendErrors := func() bool {
+		for _, err := range p.takeErrors() {
+			if !send(any(ASTerror{err}).(T)) {
+				return false
+			}
+		}
+		return true
 	}
 
-	// equality       → comparison ( ( "!=" | "==" ) comparison )* ;
-	equality = func() (ASTnode, error) {
-		left, err := comparison()
+	for p.lts.peek().Type != token.EOF {
+		v, err := parse()
 		if err != nil {
-			return left, err
+			p.fail(err)
+			p.synchronize()
+		}
+		if !sendErrors() {
+			break
 		}
+		if err != nil || any(v) == nil {
+			continue
+		}
+		if !send(v) {
+			break
+		}
+	}
+	sendErrors()
+	return context.Cause(ctx)
+}
 
-	done:
-		for {
-			o := lts.peek()
-			switch o.Type {
-			case token.BANG_EQUAL:
-				fallthrough
-			case token.EQUAL_EQUAL:
-				o = lts.consume()
-				var right ASTnode
-				right, err = comparison()
-				tmp := ASTbinary{o.Type, left, right}
-				if err != nil {
-					return tmp, err
-				}
-				left = tmp
-			default:
-				break done
-			}
+// fail records a syntax error, after any lexical errors that came before
+// it. The caller either recovers from it or, if the parser is not
+// confused, just carries on.
+func (p *parser) fail(err error) {
+	p.errors = append(append(p.errors, p.lts.takeErrors()...), err)
+}
+
+// takeErrors returns the errors seen since the last call, in source order.
+func (p *parser) takeErrors() []error {
+	errs := append(p.errors, p.lts.takeErrors()...)
+	p.errors = nil
+	return errs
+}
+
+// synchronize discards tokens until it has just passed a semicolon or is
+// looking at a keyword that starts a statement.
+func (p *parser) synchronize() {
+	p.lts.consume()
+	for t := p.lts.peek(); t.Type != token.EOF; t = p.lts.peek() {
+		if p.lts.previous().Type == token.SEMICOLON {
+			return
+		}
+		switch t.Type {
+		case token.CLASS, token.FUN, token.VAR, token.FOR, token.IF, token.WHILE, token.PRINT, token.RETURN:
+			return
 		}
+		p.lts.consume()
+	}
+}
 
-		return left, err
+// errorAt reports a syntax error against the offending token.
+func errorAt(t *token.Struct, code diagnostic.Code, message string) error {
+	return diagnostic.At(diagnostic.Syntax, code, *t, message)
+}
+
+// expect consumes the next token if it has the wanted type and reports
+// message against it otherwise.
+func (p *parser) expect(tt token.Type, message string) (*token.Struct, error) {
+	t := p.lts.peek()
+	if t.Type != tt {
+		return t, errorAt(t, diagnostic.ExpectToken, message)
 	}
+	return p.lts.consume(), nil
+}
+
+// declaration parses one declaration, returning nil if it has a syntax
+// error. The error is recorded and the parser synchronizes right here, as
+// in the book, so recovery happens at the innermost declaration and an
+// enclosing block carries on rather than failing as a whole.
+func (p *parser) declaration() ASTstmt {
+	m := p.mark()
+	stmt, err := p.tryDeclaration()
+	if err != nil {
+		p.fail(err)
+		p.synchronize()
+		p.wrap(m, "error", nil)
+		return nil
+	}
+	return stmt
+}
 
-	// comparison     → term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
-	comparison = func() (ASTnode, error) {
-		left, err := term()
+// declaration    → classDecl | funDecl | varDecl | statement ;
+func (p *parser) tryDeclaration() (ASTstmt, error) {
+	doc := p.lts.doc()
+	m := p.mark()
+	switch p.lts.peek().Type {
+	case token.CLASS:
+		p.lts.consume()
+		stmt, err := p.classDeclaration(doc)
+		return stmt, p.wrap(m, "classDecl", err)
+	case token.FUN:
+		keyword := p.lts.consume()
+		stmt, err := p.function("function", doc)
+		stmt.Location = keyword.Span.Join(stmt.Location)
+		return stmt, p.wrap(m, "funDecl", err)
+	case token.VAR:
+		p.lts.consume()
+		stmt, err := p.varDeclaration(doc)
+		return stmt, p.wrap(m, "varDecl", err)
+	}
+	return p.statement()
+}
+
+// classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" function* "}" ;
+func (p *parser) classDeclaration(doc []token.Struct) (ASTstmt, error) {
+	keyword := p.lts.previous()
+	name, err := p.expect(token.IDENTIFIER, "Expect class name.")
+	if err != nil {
+		return nil, err
+	}
+
+	var superclass *ASTvariable
+	if p.lts.peek().Type == token.LESS {
+		p.lts.consume()
+		superName, err := p.expect(token.IDENTIFIER, "Expect superclass name.")
 		if err != nil {
-			return left, err
+			return nil, err
 		}
+		superclass = &ASTvariable{Name: *superName}
+	}
+	if _, err := p.expect(token.LEFT_BRACE, "Expect '{' before class body."); err != nil {
+		return nil, err
+	}
+
+	methods := []ASTfunction{}
+	for t := p.lts.peek(); t.Type != token.RIGHT_BRACE && t.Type != token.EOF; t = p.lts.peek() {
+		m := p.mark()
+		method, err := p.function("method", p.lts.doc())
+		if err := p.wrap(m, "method", err); err != nil {
+			return nil, err
+		}
+		methods = append(methods, method)
+	}
+	close, err := p.expect(token.RIGHT_BRACE, "Expect '}' after class body.")
+	if err != nil {
+		return nil, err
+	}
+	return ASTclass{*name, superclass, methods, doc, keyword.Span.Join(close.Span)}, nil
+}
+
+// funDecl        → "fun" function ;
+// function       → IDENTIFIER "(" parameters? ")" block ;
+// parameters     → IDENTIFIER ( "," IDENTIFIER )* ;
+func (p *parser) function(kind string, doc []token.Struct) (ASTfunction, error) {
+	name, err := p.expect(token.IDENTIFIER, fmt.Sprintf("Expect %s name.", kind))
+	if err != nil {
+		return ASTfunction{}, err
+	}
+	if _, err := p.expect(token.LEFT_PAREN, fmt.Sprintf("Expect '(' after %s name.", kind)); err != nil {
+		return ASTfunction{}, err
+	}
 
-	done:
+	params := []token.Struct{}
+	if p.lts.peek().Type != token.RIGHT_PAREN {
 		for {
-			o := lts.peek()
-			switch o.Type {
-			case token.GREATER:
-				fallthrough
-			case token.GREATER_EQUAL:
-				fallthrough
-			case token.LESS:
-				fallthrough
-			case token.LESS_EQUAL:
-				o = lts.consume()
-				var right ASTnode
-				right, err = term()
-				tmp := ASTbinary{o.Type, left, right}
-				if err != nil {
-					return tmp, err
-				}
-				left = tmp
-			default:
-				break done
+			if len(params) >= maxArguments {
+				// reported, but the parser is not confused, so it carries on
+				p.fail(errorAt(p.lts.peek(), diagnostic.TooManyArguments, "Can't have more than 255 parameters."))
+			}
+			param, err := p.expect(token.IDENTIFIER, "Expect parameter name.")
+			if err != nil {
+				return ASTfunction{}, err
+			}
+			params = append(params, *param)
+			if p.lts.peek().Type != token.COMMA {
+				break
 			}
+			p.lts.consume()
 		}
+	}
+	if _, err := p.expect(token.RIGHT_PAREN, "Expect ')' after parameters."); err != nil {
+		return ASTfunction{}, err
+	}
 
-		return left, err
+	if _, err := p.expect(token.LEFT_BRACE, fmt.Sprintf("Expect '{' before %s body.", kind)); err != nil {
+		return ASTfunction{}, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return ASTfunction{}, err
+	}
+	return ASTfunction{*name, params, body, doc, name.Span.Join(p.lts.previous().Span)}, nil
+}
+
+// varDecl        → "var" IDENTIFIER ( "=" expression )? ";" ;
+func (p *parser) varDeclaration(doc []token.Struct) (ASTstmt, error) {
+	keyword := p.lts.previous()
+	name, err := p.expect(token.IDENTIFIER, "Expect variable name.")
+	if err != nil {
+		return nil, err
 	}
 
-	// term           → factor ( ( "-" | "+" ) factor )* ;
-	term = func() (ASTnode, error) {
-		left, err := factor()
+	var initializer ASTnode
+	if p.lts.peek().Type == token.EQUAL {
+		p.lts.consume()
+		initializer, err = p.expression()
 		if err != nil {
-			return left, err
+			return nil, err
 		}
+	}
 
-	done:
-		for {
-			o := lts.peek()
-			switch o.Type {
-			case token.PLUS:
-				fallthrough
-			case token.MINUS:
-				o = lts.consume()
-				var right ASTnode
-				right, err = factor()
-				tmp := ASTbinary{o.Type, left, right}
-				if err != nil {
-					return tmp, err
-				}
-				left = tmp
-			default:
-				break done
-			}
+	semicolon, err := p.expect(token.SEMICOLON, "Expect ';' after variable declaration.")
+	if err != nil {
+		return nil, err
+	}
+	return ASTvar{*name, initializer, doc, keyword.Span.Join(semicolon.Span)}, nil
+}
+
+// statement      → exprStmt | forStmt | ifStmt | printStmt | returnStmt | whileStmt | block ;
+func (p *parser) statement() (ASTstmt, error) {
+	m := p.mark()
+	var stmt ASTstmt
+	var err error
+	var kind string
+	switch p.lts.peek().Type {
+	case token.FOR:
+		p.lts.consume()
+		stmt, err = p.forStatement()
+		kind = "forStmt"
+	case token.IF:
+		p.lts.consume()
+		stmt, err = p.ifStatement()
+		kind = "ifStmt"
+	case token.PRINT:
+		p.lts.consume()
+		stmt, err = p.printStatement()
+		kind = "printStmt"
+	case token.RETURN:
+		stmt, err = p.returnStatement()
+		kind = "returnStmt"
+	case token.WHILE:
+		p.lts.consume()
+		stmt, err = p.whileStatement()
+		kind = "whileStmt"
+	case token.LEFT_BRACE:
+		open := p.lts.consume()
+		var stmts []ASTstmt
+		stmts, err = p.block()
+		if err != nil {
+			return nil, err
 		}
-		return left, err
+		stmt, kind = ASTblock{stmts, open.Span.Join(p.lts.previous().Span)}, "block"
+	default:
+		stmt, err = p.expressionStatement()
+		kind = "exprStmt"
+	}
+	return stmt, p.wrap(m, kind, err)
+}
+
+// forStmt        → "for" "(" ( varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement ;
+//
+// There is no for node: the loop is desugared into an equivalent while.
+func (p *parser) forStatement() (ASTstmt, error) {
+	keyword := p.lts.previous()
+	if _, err := p.expect(token.LEFT_PAREN, "Expect '(' after 'for'."); err != nil {
+		return nil, err
+	}
+
+	var initializer ASTstmt
+	var err error
+	m := p.mark()
+	switch p.lts.peek().Type {
+	case token.SEMICOLON:
+		p.lts.consume()
+	case token.VAR:
+		p.lts.consume()
+		initializer, err = p.varDeclaration(nil)
+		err = p.wrap(m, "varDecl", err)
+	default:
+		initializer, err = p.expressionStatement()
+		err = p.wrap(m, "exprStmt", err)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// factor         → unary ( ( "/" | "*" ) unary )* ;
-	factor = func() (ASTnode, error) {
-		left, err := unary()
+	// an omitted condition is an empty span where it would have been
+	missing := p.lts.peek().Span
+	missing.Length = 0
+	var condition ASTnode = ASTliteral{"true", BoolValue(true), missing}
+	if p.lts.peek().Type != token.SEMICOLON {
+		condition, err = p.expression()
 		if err != nil {
-			return left, err
+			return nil, err
 		}
+	}
+	if _, err := p.expect(token.SEMICOLON, "Expect ';' after loop condition."); err != nil {
+		return nil, err
+	}
 
-	done:
-		for {
-			o := lts.peek()
-			switch o.Type {
-			case token.STAR:
-				fallthrough
-			case token.SLASH:
-				o = lts.consume()
-				var right ASTnode
-				right, err = unary()
-				tmp := ASTbinary{o.Type, left, right}
-				if err != nil {
-					return tmp, err
-				}
-				left = tmp
-			default:
-				break done
-			}
+	var increment ASTnode
+	if p.lts.peek().Type != token.RIGHT_PAREN {
+		increment, err = p.expression()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(token.RIGHT_PAREN, "Expect ')' after for clauses."); err != nil {
+		return nil, err
+	}
+
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+
+	// the statements standing in for the loop cover all of it, except
+	// the block that adds the increment to the body
+	location := keyword.Span.Join(body.Span())
+	if increment != nil {
+		body = ASTblock{[]ASTstmt{body, ASTexpression{increment, increment.Span()}}, increment.Span().Join(body.Span())}
+	}
+	body = ASTwhile{condition, body, location}
+	if initializer != nil {
+		body = ASTblock{[]ASTstmt{initializer, body}, location}
+	}
+	return body, nil
+}
+
+// ifStmt         → "if" "(" expression ")" statement ( "else" statement )? ;
+func (p *parser) ifStatement() (ASTstmt, error) {
+	keyword := p.lts.previous()
+	if _, err := p.expect(token.LEFT_PAREN, "Expect '(' after 'if'."); err != nil {
+		return nil, err
+	}
+	condition, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(token.RIGHT_PAREN, "Expect ')' after if condition."); err != nil {
+		return nil, err
+	}
+
+	thenBranch, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	location := keyword.Span.Join(thenBranch.Span())
+	var elseBranch ASTstmt
+	if p.lts.peek().Type == token.ELSE {
+		p.lts.consume()
+		elseBranch, err = p.statement()
+		if err != nil {
+			return nil, err
 		}
+		location = location.Join(elseBranch.Span())
+	}
+	return ASTif{condition, thenBranch, elseBranch, location}, nil
+}
+
+// whileStmt      → "while" "(" expression ")" statement ;
+func (p *parser) whileStatement() (ASTstmt, error) {
+	keyword := p.lts.previous()
+	if _, err := p.expect(token.LEFT_PAREN, "Expect '(' after 'while'."); err != nil {
+		return nil, err
+	}
+	condition, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(token.RIGHT_PAREN, "Expect ')' after condition."); err != nil {
+		return nil, err
+	}
+
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	return ASTwhile{condition, body, keyword.Span.Join(body.Span())}, nil
+}
+
+// block          → "{" declaration* "}" ;
+func (p *parser) block() ([]ASTstmt, error) {
+	stmts := []ASTstmt{}
+	for t := p.lts.peek(); t.Type != token.RIGHT_BRACE && t.Type != token.EOF; t = p.lts.peek() {
+		if stmt := p.declaration(); stmt != nil {
+			stmts = append(stmts, stmt)
+		}
+	}
+	if _, err := p.expect(token.RIGHT_BRACE, "Expect '}' after block."); err != nil {
+		return nil, err
+	}
+	return stmts, nil
+}
+
+// printStmt      → "print" expression ";" ;
+func (p *parser) printStatement() (ASTstmt, error) {
+	keyword := p.lts.previous()
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	semicolon, err := p.expect(token.SEMICOLON, "Expect ';' after value.")
+	if err != nil {
+		return nil, err
+	}
+	return ASTprint{expr, keyword.Span.Join(semicolon.Span)}, nil
+}
+
+// returnStmt     → "return" expression? ";" ;
+func (p *parser) returnStatement() (ASTstmt, error) {
+	keyword := p.lts.consume()
+	var value ASTnode
+	if p.lts.peek().Type != token.SEMICOLON {
+		var err error
+		value, err = p.expression()
+		if err != nil {
+			return nil, err
+		}
+	}
+	semicolon, err := p.expect(token.SEMICOLON, "Expect ';' after return value.")
+	if err != nil {
+		return nil, err
+	}
+	return ASTreturn{*keyword, value, keyword.Span.Join(semicolon.Span)}, nil
+}
+
+// exprStmt       → expression ";" ;
+func (p *parser) expressionStatement() (ASTstmt, error) {
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	semicolon, err := p.expect(token.SEMICOLON, "Expect ';' after expression.")
+	if err != nil {
+		return nil, err
+	}
+	return ASTexpression{expr, expr.Span().Join(semicolon.Span)}, nil
+}
+
+// expression     → assignment ;
+func (p *parser) expression() (ASTnode, error) {
+	expr, err := p.assignment()
+	return expr, err
+}
+
+// assignment     → ( call "." )? IDENTIFIER "=" assignment | logic_or ;
+func (p *parser) assignment() (ASTnode, error) {
+	m := p.mark()
+	expr, err := p.or()
+	if err != nil {
+		return expr, err
+	}
+
+	if p.lts.peek().Type != token.EQUAL {
+		return expr, nil
+	}
+	equals := p.lts.consume()
+	value, err := p.assignment()
+	if err != nil {
+		return value, err
+	}
+
+	switch target := expr.(type) {
+	case *ASTvariable:
+		return &ASTassign{Name: target.Name, Value: value}, p.wrap(m, "assign", nil)
+	case ASTget:
+		return ASTset{target.Object, target.Name, value}, p.wrap(m, "assign", nil)
+	}
+	// reported, but the parser is not confused, so it carries on
+	p.fail(errorAt(equals, diagnostic.InvalidAssignmentTarget, "Invalid assignment target."))
+	return expr, p.wrap(m, "assign", nil)
+}
+
+// logic_or       → logic_and ( "or" logic_and )* ;
+func (p *parser) or() (ASTnode, error) {
+	m := p.mark()
+	left, err := p.and()
+	if err != nil {
 		return left, err
 	}
 
-	// unary          → ( "!" | "-" ) unary | primary ;
-	unary = func() (ASTnode, error) {
-		t := lts.peek()
-		if t.Type == token.BANG || t.Type == token.MINUS {
-			t = lts.consume()
-			prim, err := unary()
-			wrapper := ASTunary{Operator: t.Type, Contents: prim}
-			return wrapper, err
+	for p.lts.peek().Type == token.OR {
+		o := p.lts.consume()
+		var right ASTnode
+		right, err = p.and()
+		tmp := ASTlogical{*o, left, right}
+		if err != nil {
+			return tmp, err
 		}
+		left = tmp
+		p.wrap(m, "logical", nil)
+	}
+	return left, err
+}
 
-		prim, err := primary()
-		return prim, err
+// logic_and      → equality ( "and" equality )* ;
+func (p *parser) and() (ASTnode, error) {
+	m := p.mark()
+	left, err := p.equality()
+	if err != nil {
+		return left, err
+	}
+
+	for p.lts.peek().Type == token.AND {
+		o := p.lts.consume()
+		var right ASTnode
+		right, err = p.equality()
+		tmp := ASTlogical{*o, left, right}
+		if err != nil {
+			return tmp, err
+		}
+		left = tmp
+		p.wrap(m, "logical", nil)
 	}
+	return left, err
+}
 
-	group = func() (ASTnode, error) {
-		g := ASTgroup{}
+// equality       → comparison ( ( "!=" | "==" ) comparison )* ;
+func (p *parser) equality() (ASTnode, error) {
+	m := p.mark()
+	left, err := p.comparison()
+	if err != nil {
+		return left, err
+	}
 
-		c := lts.peek()
-		switch c.Type {
-		case token.EOF:
-			return g, errors.New("parse_error: EOF detected in group")
-		case token.RIGHT_PAREN:
-			return g, errors.New("parse_error: ')' detected in group")
+done:
+	for {
+		o := p.lts.peek()
+		switch o.Type {
+		case token.BANG_EQUAL:
+			fallthrough
+		case token.EQUAL_EQUAL:
+			o = p.lts.consume()
+			var right ASTnode
+			right, err = p.comparison()
+			tmp := ASTbinary{*o, left, right}
+			if err != nil {
+				return tmp, err
+			}
+			left = tmp
+			p.wrap(m, "binary", nil)
 		default:
-			node, err := expression()
+			break done
+		}
+	}
+
+	return left, err
+}
+
+// comparison     → term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
+func (p *parser) comparison() (ASTnode, error) {
+	m := p.mark()
+	left, err := p.term()
+	if err != nil {
+		return left, err
+	}
+
+done:
+	for {
+		o := p.lts.peek()
+		switch o.Type {
+		case token.GREATER:
+			fallthrough
+		case token.GREATER_EQUAL:
+			fallthrough
+		case token.LESS:
+			fallthrough
+		case token.LESS_EQUAL:
+			o = p.lts.consume()
+			var right ASTnode
+			right, err = p.term()
+			tmp := ASTbinary{*o, left, right}
 			if err != nil {
-				return g, err
+				return tmp, err
 			}
-			g.Contents = node
+			left = tmp
+			p.wrap(m, "binary", nil)
+		default:
+			break done
 		}
+	}
 
-		close := lts.consume()
-		if close.Type != token.RIGHT_PAREN {
-			return g, errors.New("parse_error: expected ')' in group")
+	return left, err
+}
+
+// term           → factor ( ( "-" | "+" ) factor )* ;
+func (p *parser) term() (ASTnode, error) {
+	m := p.mark()
+	left, err := p.factor()
+	if err != nil {
+		return left, err
+	}
+
+done:
+	for {
+		o := p.lts.peek()
+		switch o.Type {
+		case token.PLUS:
+			fallthrough
+		case token.MINUS:
+			o = p.lts.consume()
+			var right ASTnode
+			right, err = p.factor()
+			tmp := ASTbinary{*o, left, right}
+			if err != nil {
+				return tmp, err
+			}
+			left = tmp
+			p.wrap(m, "binary", nil)
+		default:
+			break done
 		}
-		return g, nil
 	}
+	return left, err
+}
 
-	// primary        → NUMBER | STRING | "true" | "false" | "nil"
-	//                | "(" expression ")" ;
-	primary = func() (ASTnode, error) {
-		t := lts.consume()
-		switch t.Type {
+// factor         → unary ( ( "/" | "*" ) unary )* ;
+func (p *parser) factor() (ASTnode, error) {
+	m := p.mark()
+	left, err := p.unary()
+	if err != nil {
+		return left, err
+	}
 
-		case token.EOF:
-			return ASTliteral{}, errors.New("parse_error: EOF detected, expected literal")
-		case token.ERROR:
-			return ASTliteral{}, errors.New(t.Lexeme)
+done:
+	for {
+		o := p.lts.peek()
+		switch o.Type {
+		case token.STAR:
+			fallthrough
+		case token.SLASH:
+			o = p.lts.consume()
+			var right ASTnode
+			right, err = p.unary()
+			tmp := ASTbinary{*o, left, right}
+			if err != nil {
+				return tmp, err
+			}
+			left = tmp
+			p.wrap(m, "binary", nil)
+		default:
+			break done
+		}
+	}
+	return left, err
+}
+
+// unary          → ( "!" | "-" ) unary | call ;
+func (p *parser) unary() (ASTnode, error) {
+	m := p.mark()
+	t := p.lts.peek()
+	if t.Type == token.BANG || t.Type == token.MINUS {
+		t = p.lts.consume()
+		prim, err := p.unary()
+		wrapper := ASTunary{Operator: *t, Contents: prim}
+		return wrapper, p.wrap(m, "unary", err)
+	}
+
+	call, err := p.call()
+	return call, err
+}
+
+// call           → primary ( "(" arguments? ")" | "." IDENTIFIER )* ;
+// arguments      → expression ( "," expression )* ;
+func (p *parser) call() (ASTnode, error) {
+	m := p.mark()
+	expr, err := p.primary()
+	if err != nil {
+		return expr, err
+	}
+
+	for {
+		switch p.lts.peek().Type {
 		case token.LEFT_PAREN:
-			node, err := group()
+			p.lts.consume()
+			expr, err = p.finishCall(expr)
+			if err := p.wrap(m, "call", err); err != nil {
+				return expr, err
+			}
+		case token.DOT:
+			p.lts.consume()
+			name, err := p.expect(token.IDENTIFIER, "Expect property name after '.'.")
 			if err != nil {
-				return ASTliteral{}, err
+				return expr, err
 			}
-			return node, nil
-		case token.RIGHT_PAREN:
-			return ASTliteral{}, fmt.Errorf("[line %d] Error at ')': Expect expression.", t.Line)
-		case token.STRING:
-			return ASTliteral{t.Literal}, nil
-		case token.NUMBER:
-			return ASTliteral{t.Literal}, nil
-		case token.IDENTIFIER:
-			return ASTliteral{t.Lexeme}, nil
-		case token.TRUE:
-			return ASTliteral{t.Lexeme}, nil
-		case token.FALSE:
-			return ASTliteral{t.Lexeme}, nil
-		case token.NIL:
-			return ASTliteral{t.Lexeme}, nil
+			expr = ASTget{expr, *name}
+			p.wrap(m, "get", nil)
 		default:
-			return ASTliteral{}, fmt.Errorf("primary: unexpected character '%v' in input", t.Type)
+			return expr, nil
+		}
+	}
+}
+
+func (p *parser) finishCall(callee ASTnode) (ASTnode, error) {
+	args := []ASTnode{}
+	if p.lts.peek().Type != token.RIGHT_PAREN {
+		for {
+			if len(args) >= maxArguments {
+				p.fail(errorAt(p.lts.peek(), diagnostic.TooManyArguments, "Can't have more than 255 arguments."))
+			}
+			arg, err := p.expression()
+			if err != nil {
+				return callee, err
+			}
+			args = append(args, arg)
+			if p.lts.peek().Type != token.COMMA {
+				break
+			}
+			p.lts.consume()
 		}
 	}
+	paren, err := p.expect(token.RIGHT_PAREN, "Expect ')' after arguments.")
+	if err != nil {
+		return callee, err
+	}
+	return ASTcall{callee, *paren, args}, nil
+}
+
+func (p *parser) group() (ASTnode, error) {
+	open := p.lts.previous()
+	node, err := p.expression()
+	if err != nil {
+		return ASTgroup{}, err
+	}
+	close, err := p.expect(token.RIGHT_PAREN, "Expect ')' after expression.")
+	if err != nil {
+		return ASTgroup{}, err
+	}
+	return ASTgroup{node, open.Span.Join(close.Span)}, nil
+}
 
-	for lts.peek().Type != token.EOF {
-		node, err := expression()
+// primary        → NUMBER | STRING | "true" | "false" | "nil" | "this" | IDENTIFIER | "(" expression ")" | "super" "." IDENTIFIER ;
+func (p *parser) primary() (ASTnode, error) {
+	m := p.mark()
+	t := p.lts.peek()
+	switch t.Type {
+	case token.LEFT_PAREN:
+		p.lts.consume()
+		node, err := p.group()
+		if err := p.wrap(m, "group", err); err != nil {
+			return ASTliteral{}, err
+		}
+		return node, nil
+	case token.STRING:
+		p.lts.consume()
+		return ASTliteral{t.Literal, StringValue(t.Literal), t.Span}, nil
+	case token.NUMBER:
+		p.lts.consume()
+		n, err := strconv.ParseFloat(t.Literal, 64)
 		if err != nil {
-			node = ASTerror{err}
+			return ASTliteral{}, errorAt(t, diagnostic.InvalidNumber, "Invalid number.")
+		}
+		return ASTliteral{t.Literal, NumberValue(n), t.Span}, nil
+	case token.IDENTIFIER:
+		p.lts.consume()
+		return &ASTvariable{Name: *t}, nil
+	case token.THIS:
+		p.lts.consume()
+		return &ASTthis{Keyword: *t}, nil
+	case token.SUPER:
+		p.lts.consume()
+		if _, err := p.expect(token.DOT, "Expect '.' after 'super'."); err != nil {
+			return ASTliteral{}, err
 		}
-		astNodes <- node
+		method, err := p.expect(token.IDENTIFIER, "Expect superclass method name.")
+		if err != nil {
+			return ASTliteral{}, err
+		}
+		return &ASTsuper{Keyword: *t, Method: *method}, p.wrap(m, "super", nil)
+	case token.TRUE:
+		p.lts.consume()
+		return ASTliteral{t.Lexeme, BoolValue(true), t.Span}, nil
+	case token.FALSE:
+		p.lts.consume()
+		return ASTliteral{t.Lexeme, BoolValue(false), t.Span}, nil
+	case token.NIL:
+		p.lts.consume()
+		return ASTliteral{t.Lexeme, NilValue{}, t.Span}, nil
+	default:
+		return ASTliteral{}, errorAt(t, diagnostic.ExpectExpression, "Expect expression.")
 	}
-	close(astNodes)
 }
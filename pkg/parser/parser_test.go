@@ -0,0 +1,1161 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+	"example.com/cjon/interpreter-starter-go/pkg/tokenizer"
+)
+
+type evalTestStruct struct {
+	name   string
+	lines  string
+	errors string
+	output string
+}
+
+var evalTests []evalTestStruct = []evalTestStruct{
+	{
+		name:   "literals",
+		lines:  `10.40`,
+		errors: ``,
+		output: `10.4
+`,
+	},
+	{
+		name:   "integers lose trailing zero",
+		lines:  `42`,
+		errors: ``,
+		output: `42
+`,
+	},
+	{
+		name:   "grouping and precedence",
+		lines:  `(1 + 2) * 3`,
+		errors: ``,
+		output: `9
+`,
+	},
+	{
+		name:   "division",
+		lines:  `(18 * 3 / (3 * 6))`,
+		errors: ``,
+		output: `3
+`,
+	},
+	{
+		name:   "string concatenation",
+		lines:  `"hello" + " " + "world"`,
+		errors: ``,
+		output: `hello world
+`,
+	},
+	{
+		name:   "unary",
+		lines:  `-(-(73 - 10))`,
+		errors: ``,
+		output: `63
+`,
+	},
+	{
+		name:   "bang",
+		lines:  `!nil`,
+		errors: ``,
+		output: `true
+`,
+	},
+	{
+		name:   "comparison",
+		lines:  `(54 - 67) >= -(114 / 57 + 11)`,
+		errors: ``,
+		output: `true
+`,
+	},
+	{
+		name:   "equality across types",
+		lines:  `"10" == 10`,
+		errors: ``,
+		output: `false
+`,
+	},
+	{
+		name:   "string equality",
+		lines:  `"foo" != "bar"`,
+		errors: ``,
+		output: `true
+`,
+	},
+	{
+		name:   "division by zero",
+		lines:  "1 / 0",
+		errors: ``,
+		output: `Infinity
+`,
+	},
+	{
+		name:   "nil equality",
+		lines:  `nil == nil`,
+		errors: ``,
+		output: `true
+`,
+	},
+	{
+		name:  "negate string",
+		lines: `-"abc"`,
+		errors: `Operand must be a number.
+[line 1]
+`,
+		output: ``,
+	},
+	{
+		name:  "compare string and number",
+		lines: `"a" < 1`,
+		errors: `Operands must be numbers.
+[line 1]
+`,
+		output: ``,
+	},
+	{
+		name: "runtime error line",
+		lines: `
+1 +
+true`,
+		errors: `Operands must be two numbers or two strings.
+[line 2]
+`,
+		output: ``,
+	},
+}
+
+func doEvalTest(lines string) (string, string) {
+	var output, errs strings.Builder
+
+	tokCh := make(chan token.Struct)
+	astCh := make(chan ASTnode)
+	go tokenizer.Tokenize(tokCh, []byte(lines))
+	go Parse(tokCh, astCh)
+	env := NewGlobalEnvironment()
+	for node := range astCh {
+		value, err := node.Evaluate(env)
+		if err != nil {
+			errs.WriteString(err.Error() + "\n")
+			continue
+		}
+		output.WriteString(value.String() + "\n")
+	}
+	return output.String(), errs.String()
+}
+
+func TestEvaluate(t *testing.T) {
+	for _, test := range evalTests {
+		t.Run(test.name, func(t *testing.T) {
+			output, errs := doEvalTest(test.lines)
+			if test.output != output {
+				t.Errorf("%s: output does not match:\n\texpected '%#v'\n\tgot    : '%#v'\n", test.name, test.output, output)
+			}
+			if test.errors != errs {
+				t.Errorf("%s: errors does not match:\n\texpected '%#v'\n\tgot    : '%#v'\n", test.name, test.errors, errs)
+			}
+		})
+	}
+}
+
+var parseTests []evalTestStruct = []evalTestStruct{
+	{
+		name:   "nested groups",
+		lines:  `("foo" + (1 * -2)) == !true`,
+		errors: ``,
+		output: `(== (group (+ foo (group (* 1.0 (- 2.0))))) (! true))
+`,
+	},
+	{
+		name:   "missing operand",
+		lines:  `(72 +)`,
+		errors: "[line 1] Error at ')': Expect expression.\n",
+		output: ``,
+	},
+	{
+		name:   "unclosed group",
+		lines:  `(1 + 2`,
+		errors: "[line 1] Error at end: Expect ')' after expression.\n",
+		output: ``,
+	},
+	{
+		name:   "unclosed group before another token",
+		lines:  `(1 "two")`,
+		errors: "[line 1] Error at '\"two\"': Expect ')' after expression.\n",
+		output: ``,
+	},
+	{
+		name:   "empty group",
+		lines:  `()`,
+		errors: "[line 1] Error at ')': Expect expression.\n",
+		output: ``,
+	},
+	{
+		name: "missing right operand",
+		lines: `
+1 *`,
+		errors: "[line 2] Error at end: Expect expression.\n",
+		output: ``,
+	},
+	{
+		name:   "unexpected token",
+		lines:  `;`,
+		errors: "[line 1] Error at ';': Expect expression.\n",
+		output: ``,
+	},
+}
+
+func doParseTest(lines string) (string, string) {
+	var output, errs strings.Builder
+
+	tokCh := make(chan token.Struct)
+	astCh := make(chan ASTnode)
+	go tokenizer.Tokenize(tokCh, []byte(lines))
+	go Parse(tokCh, astCh)
+	for node := range astCh {
+		if _, ok := node.(ASTerror); ok {
+			errs.WriteString(node.String() + "\n")
+			continue
+		}
+		output.WriteString(node.String() + "\n")
+	}
+	return output.String(), errs.String()
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		t.Run(test.name, func(t *testing.T) {
+			output, errs := doParseTest(test.lines)
+			if test.output != output {
+				t.Errorf("%s: output does not match:\n\texpected '%#v'\n\tgot    : '%#v'\n", test.name, test.output, output)
+			}
+			if test.errors != errs {
+				t.Errorf("%s: errors does not match:\n\texpected '%#v'\n\tgot    : '%#v'\n", test.name, test.errors, errs)
+			}
+		})
+	}
+}
+
+var runTests []evalTestStruct = []evalTestStruct{
+	{
+		name: "print statements",
+		lines: `
+print "hello" + " world";
+print (1 + 2) * 3;
+print true;
+`,
+		errors: ``,
+		output: `hello world
+9
+true
+`,
+	},
+	{
+		name: "expression statements",
+		lines: `
+1 + 1;
+"unused";
+print nil;
+`,
+		errors: ``,
+		output: `nil
+`,
+	},
+	{
+		name: "missing semicolon",
+		lines: `print "a";
+print "b"
+`,
+		errors: `[line 3] Error at end: Expect ';' after value.
+`,
+		output: ``,
+	},
+	{
+		name: "runtime error stops execution",
+		lines: `print "before";
+print -"x";
+print "after";
+`,
+		errors: `Operand must be a number.
+[line 2]
+`,
+		output: `before
+`,
+	},
+	{
+		name: "global variables",
+		lines: `
+var a = 1;
+var b;
+print a;
+print b;
+a = b = "x";
+print a + b;
+var a = "redeclared";
+print a;
+`,
+		errors: ``,
+		output: `1
+nil
+xx
+redeclared
+`,
+	},
+	{
+		name:   "print infinities",
+		lines:  `print 1 / 0; print -1 / 0; print 0 / 0;`,
+		errors: ``,
+		output: `Infinity
+-Infinity
+NaN
+`,
+	},
+	{
+		name:   "undefined variable",
+		lines:  `print foo;`,
+		errors: "Undefined variable 'foo'.\n[line 1]\n",
+		output: ``,
+	},
+	{
+		name:   "assign undefined variable",
+		lines:  `bar = 1;`,
+		errors: "Undefined variable 'bar'.\n[line 1]\n",
+		output: ``,
+	},
+	{
+		name:   "invalid assignment target",
+		lines:  `var a; (a) = 1;`,
+		errors: "[line 1] Error at '=': Invalid assignment target.\n",
+		output: ``,
+	},
+	{
+		name:   "invalid assignment target does not hide later errors",
+		lines:  `var x = (1 = 2) + {;`,
+		errors: "[line 1] Error at '=': Invalid assignment target.\n[line 1] Error at '{': Expect expression.\n",
+		output: ``,
+	},
+	{
+		name: "block scoping",
+		lines: `
+var a = "global a";
+var b = "global b";
+{
+  var a = "outer a";
+  {
+    var a = "inner a";
+    print a;
+    print b;
+    b = "changed b";
+  }
+  print a;
+}
+print a;
+print b;
+`,
+		errors: ``,
+		output: `inner a
+global b
+outer a
+global a
+changed b
+`,
+	},
+	{
+		name: "block locals do not leak",
+		lines: `{
+  var hidden = 1;
+}
+print hidden;
+`,
+		errors: "Undefined variable 'hidden'.\n[line 4]\n",
+		output: ``,
+	},
+	{
+		name: "unterminated block",
+		lines: `{
+  print 1;
+`,
+		errors: "[line 3] Error at end: Expect '}' after block.\n",
+		output: ``,
+	},
+	{
+		name: "if else",
+		lines: `
+if (true) print "then"; else print "else";
+if (nil) print "then"; else print "else";
+if (false) print "skipped";
+if (1) if (false) print "inner"; else print "dangling else binds inner";
+`,
+		errors: ``,
+		output: `then
+else
+dangling else binds inner
+`,
+	},
+	{
+		name: "logical operators",
+		lines: `
+print "hi" or 2;
+print nil or "yes";
+print false and 1;
+print true and "last";
+var called = false;
+false and (called = true);
+true or (called = true);
+print called;
+`,
+		errors: ``,
+		output: `hi
+yes
+false
+last
+false
+`,
+	},
+	{
+		name: "while loop",
+		lines: `
+var i = 0;
+while (i < 3) {
+  print i;
+  i = i + 1;
+}
+`,
+		errors: ``,
+		output: `0
+1
+2
+`,
+	},
+	{
+		name: "for loop",
+		lines: `
+var a = 0;
+var temp;
+for (var b = 1; a < 50; b = temp + b) {
+  print a;
+  temp = a;
+  a = b;
+}
+for (;false;) print "never";
+`,
+		errors: ``,
+		output: `0
+1
+1
+2
+3
+5
+8
+13
+21
+34
+`,
+	},
+	{
+		name: "for loop variable is scoped",
+		lines: `
+for (var i = 0; i < 1; i = i + 1) {}
+print i;
+`,
+		errors: "Undefined variable 'i'.\n[line 3]\n",
+		output: ``,
+	},
+	{
+		name:   "if without parenthesis",
+		lines:  `if true print 1;`,
+		errors: "[line 1] Error at 'true': Expect '(' after 'if'.\n",
+		output: ``,
+	},
+	{
+		name: "functions and return",
+		lines: `
+fun add(a, b) {
+  return a + b;
+}
+fun noReturn() {
+  print "side effect";
+}
+print add(1, 2);
+print noReturn();
+print add;
+print clock;
+`,
+		errors: ``,
+		output: `3
+side effect
+nil
+<fn add>
+<native fn>
+`,
+	},
+	{
+		name: "recursion",
+		lines: `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 2) + fib(n - 1);
+}
+print fib(15);
+`,
+		errors: ``,
+		output: `610
+`,
+	},
+	{
+		name: "closures",
+		lines: `
+fun makeCounter() {
+  var i = 0;
+  fun count() {
+    i = i + 1;
+    return i;
+  }
+  return count;
+}
+var counter = makeCounter();
+counter();
+print counter();
+var other = makeCounter();
+print other();
+`,
+		errors: ``,
+		output: `2
+1
+`,
+	},
+	{
+		name: "arity mismatch",
+		lines: `
+fun f(a, b) {}
+f(1);
+`,
+		errors: "Expected 2 arguments but got 1.\n[line 3]\n",
+		output: ``,
+	},
+	{
+		name:   "call non-callable",
+		lines:  `"not a function"();`,
+		errors: "Can only call functions and classes.\n[line 1]\n",
+		output: ``,
+	},
+	{
+		name:   "missing function body",
+		lines:  `fun f() print 1;`,
+		errors: "[line 1] Error at 'print': Expect '{' before function body.\n",
+		output: ``,
+	},
+	{
+		name: "closures bind statically",
+		lines: `
+var a = "global";
+{
+  fun showA() {
+    print a;
+  }
+
+  showA();
+  var a = "block";
+  showA();
+}
+`,
+		errors: ``,
+		output: `global
+global
+`,
+	},
+	{
+		name: "read local in own initializer",
+		lines: `
+var a = "outer";
+{
+  var a = a;
+}
+`,
+		errors: "[line 4] Error at 'a': Can't read local variable in its own initializer.\n",
+		output: ``,
+	},
+	{
+		name: "duplicate local",
+		lines: `
+fun bad() {
+  var a = "first";
+  var a = "second";
+}
+`,
+		errors: "[line 4] Error at 'a': Already a variable with this name in this scope.\n",
+		output: ``,
+	},
+	{
+		name:   "duplicate parameter",
+		lines:  `fun f(a, a) {}`,
+		errors: "[line 1] Error at 'a': Already a variable with this name in this scope.\n",
+		output: ``,
+	},
+	{
+		name: "top level return",
+		lines: `print "unreached";
+return "at top level";`,
+		errors: "[line 2] Error at 'return': Can't return from top-level code.\n",
+		output: ``,
+	},
+	{
+		name: "classes and instances",
+		lines: `
+class Bagel {
+  eat() {
+    print "Crunch crunch crunch!";
+  }
+}
+var bagel = Bagel();
+print Bagel;
+print bagel;
+bagel.eat();
+bagel.topping = "cream cheese";
+print bagel.topping;
+`,
+		errors: ``,
+		output: `Bagel
+Bagel instance
+Crunch crunch crunch!
+cream cheese
+`,
+	},
+	{
+		name: "methods bind this",
+		lines: `
+class Cake {
+  taste() {
+    var adjective = "delicious";
+    print "The " + this.flavor + " cake is " + adjective + "!";
+  }
+}
+var cake = Cake();
+cake.flavor = "German chocolate";
+var taste = cake.taste;
+taste();
+`,
+		errors: ``,
+		output: `The German chocolate cake is delicious!
+`,
+	},
+	{
+		name: "initializers",
+		lines: `
+class Point {
+  init(x, y) {
+    this.x = x;
+    this.y = y;
+    if (x == 0) return;
+    this.nonzero = true;
+  }
+}
+var p = Point(1, 2);
+print p.x + p.y;
+print p.init(0, 5);
+print p.y;
+print Point(0, 0).x;
+`,
+		errors: ``,
+		output: `3
+Point instance
+5
+0
+`,
+	},
+	{
+		name: "undefined property",
+		lines: `
+class A {}
+print A().missing;
+`,
+		errors: "Undefined property 'missing'.\n[line 3]\n",
+		output: ``,
+	},
+	{
+		name:   "property on non-instance",
+		lines:  `var s = "str"; s.length = 3;`,
+		errors: "Only instances have fields.\n[line 1]\n",
+		output: ``,
+	},
+	{
+		name:   "this outside class",
+		lines:  `fun f() { print this; }`,
+		errors: "[line 1] Error at 'this': Can't use 'this' outside of a class.\n",
+		output: ``,
+	},
+	{
+		name: "return value from initializer",
+		lines: `
+class A {
+  init() {
+    return 1;
+  }
+}
+`,
+		errors: "[line 4] Error at 'return': Can't return a value from an initializer.\n",
+		output: ``,
+	},
+	{
+		name: "inheritance",
+		lines: `
+class Doughnut {
+  cook() {
+    print "Fry until golden brown.";
+  }
+  name() {
+    return "doughnut";
+  }
+}
+class BostonCream < Doughnut {
+  cook() {
+    super.cook();
+    print "Pipe full of custard and coat with chocolate.";
+  }
+}
+BostonCream().cook();
+print BostonCream().name();
+`,
+		errors: ``,
+		output: `Fry until golden brown.
+Pipe full of custard and coat with chocolate.
+doughnut
+`,
+	},
+	{
+		name: "super binds to the declaring class",
+		lines: `
+class A {
+  method() {
+    print "A method";
+  }
+}
+class B < A {
+  method() {
+    print "B method";
+  }
+  test() {
+    super.method();
+  }
+}
+class C < B {}
+C().test();
+`,
+		errors: ``,
+		output: `A method
+`,
+	},
+	{
+		name: "inherited initializer",
+		lines: `
+class Base {
+  init(value) {
+    this.value = value;
+  }
+}
+class Derived < Base {}
+print Derived(7).value;
+`,
+		errors: ``,
+		output: `7
+`,
+	},
+	{
+		name: "inherit from non-class",
+		lines: `
+var NotAClass = "I am totally not a class";
+class Subclass < NotAClass {}
+`,
+		errors: "Superclass must be a class.\n[line 3]\n",
+		output: ``,
+	},
+	{
+		name:   "inherit from itself",
+		lines:  `class Oops < Oops {}`,
+		errors: "[line 1] Error at 'Oops': A class can't inherit from itself.\n",
+		output: ``,
+	},
+	{
+		name:   "super outside class",
+		lines:  `super.notEvenInAClass();`,
+		errors: "[line 1] Error at 'super': Can't use 'super' outside of a class.\n",
+		output: ``,
+	},
+	{
+		name: "super without superclass",
+		lines: `
+class Base {
+  method() {
+    super.method();
+  }
+}
+`,
+		errors: "[line 4] Error at 'super': Can't use 'super' in a class with no superclass.\n",
+		output: ``,
+	},
+	{
+		name: "reports every independent syntax error",
+		lines: `
+var = 1;
+print "fine";
+print 1 +;
+fun f( { }
+class C { method() { print } }
+print "also fine";
+`,
+		errors: `[line 2] Error at '=': Expect variable name.
+[line 4] Error at ';': Expect expression.
+[line 5] Error at '{': Expect parameter name.
+[line 6] Error at '}': Expect expression.
+[line 8] Error at end: Expect '}' after block.
+`,
+		output: ``,
+	},
+	{
+		name: "recovers inside a function body",
+		lines: `
+fun f() {
+  var = 1;
+  print 2;
+}
+`,
+		errors: `[line 3] Error at '=': Expect variable name.
+`,
+		output: ``,
+	},
+	{
+		name: "recovers inside a method body",
+		lines: `
+class A { m() { print (; } n() {} }
+`,
+		errors: `[line 2] Error at ';': Expect expression.
+`,
+		output: ``,
+	},
+	{
+		name: "lexical errors do not cascade",
+		lines: `print 1 @ ;
+print "unterminated;
+`,
+		errors: `[line 1] Error: Unexpected character: @
+[line 3] Error: Unterminated string.
+[line 3] Error at end: Expect expression.
+`,
+		output: ``,
+	},
+	{
+		name: "deep recursion within the limit",
+		lines: `fun count(n) {
+  if (n == 0) return 0;
+  return 1 + count(n - 1);
+}
+print count(5000);
+`,
+		errors: ``,
+		output: `5000
+`,
+	},
+	{
+		name: "unbounded recursion overflows the stack",
+		lines: `fun f(n) {
+  return f(n + 1);
+}
+print "before";
+f(0);
+print "after";
+`,
+		errors: "Stack overflow.\n[line 2]\n",
+		output: `before
+`,
+	},
+}
+
+func doRunTest(lines string) (string, string) {
+	var errs strings.Builder
+
+	tokCh := make(chan token.Struct)
+	stmtCh := make(chan ASTstmt)
+	go tokenizer.Tokenize(tokCh, []byte(lines))
+	go ParseProgram(tokCh, stmtCh)
+	program := []ASTstmt{}
+	for stmt := range stmtCh {
+		if _, ok := stmt.(ASTerror); ok {
+			errs.WriteString(stmt.String() + "\n")
+			continue
+		}
+		program = append(program, stmt)
+	}
+	if errs.Len() > 0 {
+		return "", errs.String()
+	}
+	for _, err := range Resolve(program) {
+		errs.WriteString(err.Error() + "\n")
+	}
+	if errs.Len() > 0 {
+		return "", errs.String()
+	}
+
+	var output strings.Builder
+	env := NewGlobalEnvironment()
+	env.SetOutput(&output)
+	for _, stmt := range program {
+		if err := stmt.Execute(env); err != nil {
+			errs.WriteString(err.Error() + "\n")
+			break
+		}
+	}
+	return output.String(), errs.String()
+}
+
+func TestRun(t *testing.T) {
+	for _, test := range runTests {
+		t.Run(test.name, func(t *testing.T) {
+			output, errs := doRunTest(test.lines)
+			if test.output != output {
+				t.Errorf("%s: output does not match:\n\texpected '%#v'\n\tgot    : '%#v'\n", test.name, test.output, output)
+			}
+			if test.errors != errs {
+				t.Errorf("%s: errors does not match:\n\texpected '%#v'\n\tgot    : '%#v'\n", test.name, test.errors, errs)
+			}
+		})
+	}
+}
+
+func TestTooManyArguments(t *testing.T) {
+	names := make([]string, maxArguments+1)
+	for i := range names {
+		names[i] = fmt.Sprintf("a%d", i)
+	}
+	list := strings.Join(names, ", ")
+	tests := []struct {
+		name   string
+		lines  string
+		errors string
+	}{
+		{
+			name:   "parameters",
+			lines:  "fun f(" + list + ") { print 1; }",
+			errors: "[line 1] Error at 'a255': Can't have more than 255 parameters.\n",
+		},
+		{
+			name:   "arguments",
+			lines:  "f(" + list + "); print {;",
+			errors: "[line 1] Error at 'a255': Can't have more than 255 arguments.\n[line 1] Error at '{': Expect expression.\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, errs := doRunTest(test.lines); errs != test.errors {
+				t.Errorf("errors do not match:\n\texpected '%#v'\n\tgot    : '%#v'", test.errors, errs)
+			}
+		})
+	}
+}
+
+func TestBlockErrorKeepsEnclosingScope(t *testing.T) {
+	tokCh := make(chan token.Struct)
+	stmtCh := make(chan ASTstmt)
+	go tokenizer.Tokenize(tokCh, []byte(`var a = "outer"; { var a = "inner"; -a; }`))
+	go ParseProgram(tokCh, stmtCh)
+	program := []ASTstmt{}
+	for stmt := range stmtCh {
+		program = append(program, stmt)
+	}
+	if errs := Resolve(program); len(errs) > 0 {
+		t.Fatalf("unexpected resolve errors: %v", errs)
+	}
+
+	env := NewGlobalEnvironment()
+	var err error
+	for _, stmt := range program {
+		err = stmt.Execute(env)
+	}
+	if _, ok := err.(RuntimeError); !ok {
+		t.Fatalf("expected a runtime error, got %v", err)
+	}
+
+	a, err := env.Get(token.Struct{Type: token.IDENTIFIER, Lexeme: "a"})
+	if err != nil || a != StringValue("outer") {
+		t.Errorf("expected a to be \"outer\" after the block, got %v (%v)", a, err)
+	}
+}
+
+func TestExpressionSpans(t *testing.T) {
+	lines := "1 +\n (foo.bar(2) * -x)"
+	tokCh := make(chan token.Struct)
+	astCh := make(chan ASTnode)
+	go tokenizer.Tokenize(tokCh, []byte(lines))
+	go Parse(tokCh, astCh)
+
+	node := <-astCh
+	for range astCh {
+	}
+	expected := token.Span{Line: 1, Column: 1, Offset: 0, Length: len(lines)}
+	if node.Span() != expected {
+		t.Fatalf("expected span %+v, got %+v", expected, node.Span())
+	}
+
+	group := node.(ASTbinary).Right.(ASTgroup)
+	call := group.Contents.(ASTbinary).Left
+	if got := lines[call.Span().Offset:call.Span().End()]; got != "foo.bar(2)" {
+		t.Errorf("call span covers %q", got)
+	}
+	if call.Span().Line != 2 || call.Span().Column != 3 {
+		t.Errorf("call starts at %d:%d, expected 2:3", call.Span().Line, call.Span().Column)
+	}
+}
+
+func TestStatementSpans(t *testing.T) {
+	expected := []string{
+		"var a = 1;",
+		"print a;",
+		"a = 2;",
+		"{ print a; }",
+		"if (a) print 1; else { print 2; }",
+		"while (a) a = nil;",
+		"for (;;) print 3;",
+		"fun f(x) {\n  return x;\n}",
+		"class C < B { m() {} }",
+	}
+	lines := strings.Join(expected, "\n ")
+	tokCh := make(chan token.Struct)
+	stmtCh := make(chan ASTstmt)
+	go tokenizer.Tokenize(tokCh, []byte(lines))
+	go ParseProgram(tokCh, stmtCh)
+
+	var got []string
+	var program []ASTstmt
+	for stmt := range stmtCh {
+		got = append(got, lines[stmt.Span().Offset:stmt.Span().End()])
+		program = append(program, stmt)
+	}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("statement spans cover\n\t%q\nexpected\n\t%q", got, expected)
+	}
+
+	fn := program[7].(ASTfunction)
+	if got := lines[fn.Body[0].Span().Offset:fn.Body[0].Span().End()]; got != "return x;" {
+		t.Errorf("return span covers %q", got)
+	}
+	if span := fn.Body[0].Span(); span.Line != 9 || span.Column != 3 {
+		t.Errorf("return starts at %d:%d, expected 9:3", span.Line, span.Column)
+	}
+	condition := program[6].(ASTwhile).Condition
+	if span := condition.Span(); span.Offset != strings.Index(lines, "for (;;)")+6 || span.Length != 0 {
+		t.Errorf("omitted for condition has span %+v", span)
+	}
+}
+
+func TestParseContextStopsEarly(t *testing.T) {
+	// an embedder that only wants the first expression of an endless input
+	stop := errors.New("have what I need")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	source := io.MultiReader(strings.NewReader("1 + 2 "), infiniteReader{})
+
+	tokCh := make(chan token.Struct)
+	astCh := make(chan ASTnode)
+	tokDone := make(chan error)
+	parseDone := make(chan error)
+	go func() { tokDone <- tokenizer.TokenizeContext(ctx, tokCh, source) }()
+	go func() { parseDone <- ParseContext(ctx, tokCh, astCh) }()
+
+	if first := <-astCh; first.String() != "(+ 1.0 2.0)" {
+		t.Errorf("expected (+ 1.0 2.0), got %v", first)
+	}
+	cancel(stop)
+
+	for range astCh {
+	}
+	if err := <-parseDone; !errors.Is(err, stop) {
+		t.Errorf("parser: expected %v, got %v", stop, err)
+	}
+	if err := <-tokDone; !errors.Is(err, stop) {
+		t.Errorf("tokenizer: expected %v, got %v", stop, err)
+	}
+}
+
+func TestParseProgramContextCancelledWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tokCh := make(chan token.Struct) // nothing is ever sent
+	stmtCh := make(chan ASTstmt)
+	done := make(chan error)
+	go func() { done <- ParseProgramContext(ctx, tokCh, stmtCh) }()
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if stmt, ok := <-stmtCh; ok {
+		t.Errorf("expected a closed channel, got %v", stmt)
+	}
+}
+
+// infiniteReader produces an endless run of "1 " expressions.
+type infiniteReader struct{}
+
+func (infiniteReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = " 1"[i%2]
+	}
+	return len(p), nil
+}
+
+func TestDocComments(t *testing.T) {
+	lines := `/// A counter.
+/// Starts at zero.
+class Counter {
+  /// Bumps the count.
+  bump() { this.n = this.n + 1; }
+  reset() { this.n = 0; }
+}
+/// stray, documents nothing
+print 1;
+fun f() {
+  /// The answer.
+  var x = 42;
+}`
+	tokCh := make(chan token.Struct)
+	stmtCh := make(chan ASTstmt)
+	go tokenizer.TokenizeMode(context.Background(), tokCh, strings.NewReader(lines), tokenizer.DocComments)
+	go ParseProgram(tokCh, stmtCh)
+	stmts := []ASTstmt{}
+	for stmt := range stmtCh {
+		if e, ok := stmt.(ASTerror); ok {
+			t.Fatalf("unexpected error: %v", e.Err())
+		}
+		stmts = append(stmts, stmt)
+	}
+
+	text := func(doc []token.Struct) string {
+		lines := []string{}
+		for _, d := range doc {
+			lines = append(lines, d.Literal)
+		}
+		return strings.Join(lines, "|")
+	}
+	class := stmts[0].(ASTclass)
+	f := stmts[2].(ASTfunction)
+	checks := []struct {
+		what     string
+		doc      []token.Struct
+		expected string
+	}{
+		{"class", class.Doc, "A counter.|Starts at zero."},
+		{"bump", class.Methods[0].Doc, "Bumps the count."},
+		{"reset", class.Methods[1].Doc, ""},
+		{"f", f.Doc, ""},
+		{"x", f.Body[0].(ASTvar).Doc, "The answer."},
+	}
+	for _, c := range checks {
+		if got := text(c.doc); got != c.expected {
+			t.Errorf("%s: expected doc %q, got %q", c.what, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package parser
+
+import (
+	"example.com/cjon/interpreter-starter-go/pkg/diagnostic"
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+// binding records where the resolver found the variable an expression
+// refers to: depth scopes out from where it is used, or in the globals if
+// it isn't local.
+type binding struct {
+	depth int
+	local bool
+}
+
+type functionType int
+
+const (
+	noFunction functionType = iota
+	inFunction
+	inMethod
+	inInitializer
+)
+
+type classType int
+
+const (
+	noClass classType = iota
+	inClass
+	inSubclass
+)
+
+type resolver struct {
+	// scopes holds one map per enclosing local scope; a name maps to false
+	// while its initializer is being resolved and to true once defined.
+	scopes          []map[string]bool
+	currentFunction functionType
+	currentClass    classType
+	errs            []error
+}
+
+// Resolve binds every variable reference in program to the scope that
+// declares it and reports the static errors that the grammar alone can't
+// catch. It must run before the program is executed.
+func Resolve(program []ASTstmt) []error {
+	r := resolver{}
+	r.resolveStmts(program)
+	return r.errs
+}
+
+func (r *resolver) error(t token.Struct, code diagnostic.Code, message string) {
+	r.errs = append(r.errs, diagnostic.At(diagnostic.Resolution, code, t, message))
+}
+
+func (r *resolver) beginScope() {
+	r.scopes = append(r.scopes, map[string]bool{})
+}
+
+func (r *resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *resolver) declare(name token.Struct) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	scope := r.scopes[len(r.scopes)-1]
+	if _, ok := scope[name.Lexeme]; ok {
+		r.error(name, diagnostic.DuplicateLocal, "Already a variable with this name in this scope.")
+	}
+	scope[name.Lexeme] = false
+}
+
+func (r *resolver) define(name token.Struct) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	r.scopes[len(r.scopes)-1][name.Lexeme] = true
+}
+
+func (r *resolver) resolveLocal(b *binding, name token.Struct) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, ok := r.scopes[i][name.Lexeme]; ok {
+			b.depth = len(r.scopes) - 1 - i
+			b.local = true
+			return
+		}
+	}
+}
+
+func (r *resolver) resolveFunction(fn ASTfunction, ft functionType) {
+	enclosing := r.currentFunction
+	r.currentFunction = ft
+	defer func() { r.currentFunction = enclosing }()
+
+	r.beginScope()
+	for _, param := range fn.Params {
+		r.declare(param)
+		r.define(param)
+	}
+	r.resolveStmts(fn.Body)
+	r.endScope()
+}
+
+func (r *resolver) resolveStmts(stmts []ASTstmt) {
+	for _, stmt := range stmts {
+		r.resolveStmt(stmt)
+	}
+}
+
+func (r *resolver) resolveStmt(stmt ASTstmt) {
+	switch s := stmt.(type) {
+	case ASTblock:
+		r.beginScope()
+		r.resolveStmts(s.Statements)
+		r.endScope()
+	case ASTvar:
+		r.declare(s.Name)
+		if s.Initializer != nil {
+			r.resolveExpr(s.Initializer)
+		}
+		r.define(s.Name)
+	case ASTfunction:
+		r.declare(s.Name)
+		r.define(s.Name)
+		r.resolveFunction(s, inFunction)
+	case ASTexpression:
+		r.resolveExpr(s.Expression)
+	case ASTprint:
+		r.resolveExpr(s.Expression)
+	case ASTif:
+		r.resolveExpr(s.Condition)
+		r.resolveStmt(s.ThenBranch)
+		if s.ElseBranch != nil {
+			r.resolveStmt(s.ElseBranch)
+		}
+	case ASTwhile:
+		r.resolveExpr(s.Condition)
+		r.resolveStmt(s.Body)
+	case ASTreturn:
+		if r.currentFunction == noFunction {
+			r.error(s.Keyword, diagnostic.TopLevelReturn, "Can't return from top-level code.")
+		}
+		if s.Value != nil {
+			if r.currentFunction == inInitializer {
+				r.error(s.Keyword, diagnostic.InitializerReturn, "Can't return a value from an initializer.")
+			}
+			r.resolveExpr(s.Value)
+		}
+	case ASTclass:
+		enclosing := r.currentClass
+		r.currentClass = inClass
+		defer func() { r.currentClass = enclosing }()
+
+		r.declare(s.Name)
+		r.define(s.Name)
+
+		if s.Superclass != nil {
+			if s.Superclass.Name.Lexeme == s.Name.Lexeme {
+				r.error(s.Superclass.Name, diagnostic.InheritFromSelf, "A class can't inherit from itself.")
+			}
+			r.currentClass = inSubclass
+			r.resolveExpr(s.Superclass)
+
+			r.beginScope()
+			r.scopes[len(r.scopes)-1]["super"] = true
+		}
+
+		r.beginScope()
+		r.scopes[len(r.scopes)-1]["this"] = true
+		for _, method := range s.Methods {
+			ft := inMethod
+			if method.Name.Lexeme == "init" {
+				ft = inInitializer
+			}
+			r.resolveFunction(method, ft)
+		}
+		r.endScope()
+
+		if s.Superclass != nil {
+			r.endScope()
+		}
+	}
+}
+
+func (r *resolver) resolveExpr(expr ASTnode) {
+	switch e := expr.(type) {
+	case *ASTvariable:
+		if len(r.scopes) > 0 {
+			if defined, ok := r.scopes[len(r.scopes)-1][e.Name.Lexeme]; ok && !defined {
+				r.error(e.Name, diagnostic.OwnInitializer, "Can't read local variable in its own initializer.")
+			}
+		}
+		r.resolveLocal(&e.binding, e.Name)
+	case *ASTassign:
+		r.resolveExpr(e.Value)
+		r.resolveLocal(&e.binding, e.Name)
+	case *ASTthis:
+		if r.currentClass == noClass {
+			r.error(e.Keyword, diagnostic.ThisOutsideClass, "Can't use 'this' outside of a class.")
+			return
+		}
+		r.resolveLocal(&e.binding, e.Keyword)
+	case *ASTsuper:
+		switch r.currentClass {
+		case noClass:
+			r.error(e.Keyword, diagnostic.SuperOutsideClass, "Can't use 'super' outside of a class.")
+			return
+		case inClass:
+			r.error(e.Keyword, diagnostic.SuperWithoutSubclass, "Can't use 'super' in a class with no superclass.")
+			return
+		}
+		r.resolveLocal(&e.binding, e.Keyword)
+	case ASTget:
+		r.resolveExpr(e.Object)
+	case ASTset:
+		r.resolveExpr(e.Value)
+		r.resolveExpr(e.Object)
+	case ASTbinary:
+		r.resolveExpr(e.Left)
+		r.resolveExpr(e.Right)
+	case ASTlogical:
+		r.resolveExpr(e.Left)
+		r.resolveExpr(e.Right)
+	case ASTunary:
+		r.resolveExpr(e.Contents)
+	case ASTgroup:
+		r.resolveExpr(e.Contents)
+	case ASTcall:
+		r.resolveExpr(e.Callee)
+		for _, arg := range e.Arguments {
+			r.resolveExpr(arg)
+		}
+	}
+}
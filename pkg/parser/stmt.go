@@ -0,0 +1,315 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"example.com/cjon/interpreter-starter-go/pkg/diagnostic"
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+// ASTstmt is a statement: it is executed for its effect rather than
+// evaluated for a value.
+type ASTstmt interface {
+	Node
+	Execute(env *Environment) error
+	// Span covers the statement from its first token through its
+	// terminator: the ";" or the closing brace of its last block.
+	Span() token.Span
+}
+
+func (e ASTerror) Execute(env *Environment) error {
+	return e.err
+}
+
+type ASTprint struct {
+	Expression ASTnode
+	Location   token.Span
+}
+
+func (s ASTprint) String() string {
+	return fmt.Sprintf("(print %s)", s.Expression)
+}
+
+func (s ASTprint) Execute(env *Environment) error {
+	value, err := s.Expression.Evaluate(env)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Globals().out, value)
+	return nil
+}
+
+func (s ASTprint) Span() token.Span {
+	return s.Location
+}
+
+type ASTexpression struct {
+	Expression ASTnode
+	Location   token.Span
+}
+
+func (s ASTexpression) String() string {
+	return fmt.Sprintf("(; %s)", s.Expression)
+}
+
+func (s ASTexpression) Execute(env *Environment) error {
+	_, err := s.Expression.Evaluate(env)
+	return err
+}
+
+func (s ASTexpression) Span() token.Span {
+	return s.Location
+}
+
+type ASTvar struct {
+	Name        token.Struct
+	Initializer ASTnode
+	Doc         []token.Struct // the /// comments just before the declaration
+	Location    token.Span
+}
+
+func (s ASTvar) String() string {
+	if s.Initializer == nil {
+		return fmt.Sprintf("(var %s)", s.Name.Lexeme)
+	}
+	return fmt.Sprintf("(var %s %s)", s.Name.Lexeme, s.Initializer)
+}
+
+func (s ASTvar) Execute(env *Environment) error {
+	var value Value = NilValue{}
+	if s.Initializer != nil {
+		var err error
+		value, err = s.Initializer.Evaluate(env)
+		if err != nil {
+			return err
+		}
+	}
+	env.Define(s.Name.Lexeme, value)
+	return nil
+}
+
+func (s ASTvar) Span() token.Span {
+	return s.Location
+}
+
+type ASTblock struct {
+	Statements []ASTstmt
+	Location   token.Span
+}
+
+func (s ASTblock) String() string {
+	var sb strings.Builder
+	sb.WriteString("(block")
+	for _, stmt := range s.Statements {
+		sb.WriteString(" ")
+		sb.WriteString(stmt.String())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (s ASTblock) Execute(env *Environment) error {
+	return executeBlock(s.Statements, NewEnvironment(env))
+}
+
+func (s ASTblock) Span() token.Span {
+	return s.Location
+}
+
+// executeBlock runs stmts in env. The caller's environment is never
+// mutated, so the enclosing scope is back in effect as soon as this
+// returns, whether or not a statement failed.
+func executeBlock(stmts []ASTstmt, env *Environment) error {
+	for _, stmt := range stmts {
+		if err := stmt.Execute(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ASTif struct {
+	Condition  ASTnode
+	ThenBranch ASTstmt
+	ElseBranch ASTstmt
+	Location   token.Span
+}
+
+func (s ASTif) String() string {
+	if s.ElseBranch == nil {
+		return fmt.Sprintf("(if %s %s)", s.Condition, s.ThenBranch)
+	}
+	return fmt.Sprintf("(if %s %s %s)", s.Condition, s.ThenBranch, s.ElseBranch)
+}
+
+func (s ASTif) Execute(env *Environment) error {
+	condition, err := s.Condition.Evaluate(env)
+	if err != nil {
+		return err
+	}
+	if IsTruthy(condition) {
+		return s.ThenBranch.Execute(env)
+	}
+	if s.ElseBranch != nil {
+		return s.ElseBranch.Execute(env)
+	}
+	return nil
+}
+
+func (s ASTif) Span() token.Span {
+	return s.Location
+}
+
+type ASTwhile struct {
+	Condition ASTnode
+	Body      ASTstmt
+	Location  token.Span
+}
+
+func (s ASTwhile) String() string {
+	return fmt.Sprintf("(while %s %s)", s.Condition, s.Body)
+}
+
+func (s ASTwhile) Execute(env *Environment) error {
+	for {
+		condition, err := s.Condition.Evaluate(env)
+		if err != nil {
+			return err
+		}
+		if !IsTruthy(condition) {
+			return nil
+		}
+		if err := s.Body.Execute(env); err != nil {
+			return err
+		}
+	}
+}
+
+func (s ASTwhile) Span() token.Span {
+	return s.Location
+}
+
+type ASTfunction struct {
+	Name     token.Struct
+	Params   []token.Struct
+	Body     []ASTstmt
+	Doc      []token.Struct // the /// comments just before the declaration
+	Location token.Span
+}
+
+func (s ASTfunction) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "(fun %s (", s.Name.Lexeme)
+	for i, param := range s.Params {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(param.Lexeme)
+	}
+	sb.WriteString(")")
+	for _, stmt := range s.Body {
+		sb.WriteString(" ")
+		sb.WriteString(stmt.String())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (s ASTfunction) Execute(env *Environment) error {
+	env.Define(s.Name.Lexeme, &Function{declaration: s, closure: env})
+	return nil
+}
+
+func (s ASTfunction) Span() token.Span {
+	return s.Location
+}
+
+type ASTreturn struct {
+	Keyword  token.Struct
+	Value    ASTnode
+	Location token.Span
+}
+
+func (s ASTreturn) String() string {
+	if s.Value == nil {
+		return "(return)"
+	}
+	return fmt.Sprintf("(return %s)", s.Value)
+}
+
+func (s ASTreturn) Execute(env *Environment) error {
+	var value Value = NilValue{}
+	if s.Value != nil {
+		var err error
+		value, err = s.Value.Evaluate(env)
+		if err != nil {
+			return err
+		}
+	}
+	return returnValue{value}
+}
+
+func (s ASTreturn) Span() token.Span {
+	return s.Location
+}
+
+type ASTclass struct {
+	Name       token.Struct
+	Superclass *ASTvariable
+	Methods    []ASTfunction
+	Doc        []token.Struct // the /// comments just before the declaration
+	Location   token.Span
+}
+
+func (s ASTclass) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "(class %s", s.Name.Lexeme)
+	if s.Superclass != nil {
+		fmt.Fprintf(&sb, " < %s", s.Superclass)
+	}
+	for _, method := range s.Methods {
+		sb.WriteString(" ")
+		sb.WriteString(method.String())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (s ASTclass) Execute(env *Environment) error {
+	var superclass *Class
+	if s.Superclass != nil {
+		value, err := s.Superclass.Evaluate(env)
+		if err != nil {
+			return err
+		}
+		class, ok := value.(*Class)
+		if !ok {
+			return RuntimeError{s.Superclass.Name, diagnostic.SuperclassNotClass, "Superclass must be a class."}
+		}
+		superclass = class
+
+		// methods close over an extra scope holding "super"
+		env = NewEnvironment(env)
+		env.Define("super", superclass)
+	}
+
+	methods := map[string]*Function{}
+	for _, method := range s.Methods {
+		methods[method.Name.Lexeme] = &Function{
+			declaration:   method,
+			closure:       env,
+			isInitializer: method.Name.Lexeme == "init",
+		}
+	}
+	class := &Class{name: s.Name.Lexeme, superclass: superclass, methods: methods}
+	if superclass != nil {
+		env = env.enclosing
+	}
+	env.Define(s.Name.Lexeme, class)
+	return nil
+}
+
+func (s ASTclass) Span() token.Span {
+	return s.Location
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Value is anything a Lox expression can evaluate to.
+type Value interface {
+	fmt.Stringer
+}
+
+type NilValue struct{}
+
+func (NilValue) String() string {
+	return "nil"
+}
+
+type BoolValue bool
+
+func (b BoolValue) String() string {
+	return strconv.FormatBool(bool(b))
+}
+
+type NumberValue float64
+
+// String formats numbers the way Lox prints them: integers lose their
+// trailing ".0", everything else uses the shortest exact representation,
+// and infinities are spelled out as in the reference implementation.
+func (n NumberValue) String() string {
+	switch {
+	case math.IsInf(float64(n), 1):
+		return "Infinity"
+	case math.IsInf(float64(n), -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(float64(n), 'f', -1, 64)
+}
+
+type StringValue string
+
+func (s StringValue) String() string {
+	return string(s)
+}
+
+// IsTruthy follows Lox semantics: nil and false are falsey, everything
+// else is truthy.
+func IsTruthy(v Value) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case NilValue:
+		return false
+	case BoolValue:
+		return bool(v)
+	default:
+		return true
+	}
+}
+
+// IsEqual compares two values without any implicit conversions; values of
+// different types are never equal.
+func IsEqual(a, b Value) bool {
+	if a == nil {
+		a = NilValue{}
+	}
+	if b == nil {
+		b = NilValue{}
+	}
+	return a == b
+}
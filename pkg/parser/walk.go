@@ -0,0 +1,136 @@
+package parser
+
+import "fmt"
+
+// Node is any node of the syntax tree: an ASTnode or an ASTstmt.
+type Node interface {
+	fmt.Stringer
+	node() // only the AST types of this package implement Node
+}
+
+func (ASTerror) node()     {}
+func (ASTgroup) node()     {}
+func (ASTliteral) node()   {}
+func (*ASTvariable) node() {}
+func (*ASTassign) node()   {}
+func (ASTlogical) node()   {}
+func (ASTcall) node()      {}
+func (ASTget) node()       {}
+func (ASTset) node()       {}
+func (*ASTthis) node()     {}
+func (*ASTsuper) node()    {}
+func (ASTunary) node()     {}
+func (ASTbinary) node()    {}
+
+func (ASTprint) node()      {}
+func (ASTexpression) node() {}
+func (ASTvar) node()        {}
+func (ASTblock) node()      {}
+func (ASTif) node()         {}
+func (ASTwhile) node()      {}
+func (ASTfunction) node()   {}
+func (ASTreturn) node()     {}
+func (ASTclass) node()      {}
+
+// A Visitor's Visit method is called by Walk for each node. If it returns
+// a non-nil Visitor w, Walk visits each child of the node with w and then
+// calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order, children in
+// source order. It calls v.Visit(node), and unless that returns nil walks
+// each child with the visitor it returned. Missing optional parts, such
+// as a var without an initializer, are skipped rather than visited as nil.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case ASTerror, ASTliteral, *ASTvariable, *ASTthis, *ASTsuper:
+		// no children
+	case ASTgroup:
+		Walk(v, n.Contents)
+	case *ASTassign:
+		Walk(v, n.Value)
+	case ASTlogical:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case ASTcall:
+		Walk(v, n.Callee)
+		for _, arg := range n.Arguments {
+			Walk(v, arg)
+		}
+	case ASTget:
+		Walk(v, n.Object)
+	case ASTset:
+		Walk(v, n.Object)
+		Walk(v, n.Value)
+	case ASTunary:
+		Walk(v, n.Contents)
+	case ASTbinary:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case ASTprint:
+		Walk(v, n.Expression)
+	case ASTexpression:
+		Walk(v, n.Expression)
+	case ASTvar:
+		if n.Initializer != nil {
+			Walk(v, n.Initializer)
+		}
+	case ASTblock:
+		walkList(v, n.Statements)
+	case ASTif:
+		Walk(v, n.Condition)
+		Walk(v, n.ThenBranch)
+		if n.ElseBranch != nil {
+			Walk(v, n.ElseBranch)
+		}
+	case ASTwhile:
+		Walk(v, n.Condition)
+		Walk(v, n.Body)
+	case ASTfunction:
+		walkList(v, n.Body)
+	case ASTreturn:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case ASTclass:
+		if n.Superclass != nil {
+			Walk(v, n.Superclass)
+		}
+		for _, method := range n.Methods {
+			Walk(v, method)
+		}
+	default:
+		panic(fmt.Sprintf("parser.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkList(v Visitor, stmts []ASTstmt) {
+	for _, stmt := range stmts {
+		Walk(v, stmt)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node like Walk, calling f for each
+// node and then f(nil) once its children are done. If f returns false the
+// node's children are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
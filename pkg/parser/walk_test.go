@@ -0,0 +1,89 @@
+package parser_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"example.com/cjon/interpreter-starter-go/pkg/parser"
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+	"example.com/cjon/interpreter-starter-go/pkg/tokenizer"
+)
+
+func parseProgram(t *testing.T, lines string) []parser.ASTstmt {
+	tokCh := make(chan token.Struct)
+	stmtCh := make(chan parser.ASTstmt)
+	go tokenizer.Tokenize(tokCh, []byte(lines))
+	go parser.ParseProgram(tokCh, stmtCh)
+	program := []parser.ASTstmt{}
+	for stmt := range stmtCh {
+		if e, ok := stmt.(parser.ASTerror); ok {
+			t.Fatalf("unexpected error: %v", e.Err())
+		}
+		program = append(program, stmt)
+	}
+	return program
+}
+
+// tracer records the nodes it enters and leaves, the way a printer or a
+// scope-tracking resolver would.
+type tracer struct {
+	events *[]string
+}
+
+func (tr tracer) Visit(node parser.Node) parser.Visitor {
+	if node == nil {
+		*tr.events = append(*tr.events, ")")
+		return nil
+	}
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "parser.AST")
+	*tr.events = append(*tr.events, "("+strings.TrimPrefix(name, "*parser.AST"))
+	return tr
+}
+
+func TestWalk(t *testing.T) {
+	program := parseProgram(t, `class B < A {
+  m(x) { return super.m(x) or this.y; }
+}
+var v;
+if (!v) print -(1 + 2); else { v = f(3).z = "s"; }
+while (false) return;`)
+
+	trees := []string{}
+	for _, stmt := range program {
+		events := []string{}
+		parser.Walk(tracer{&events}, stmt)
+		trees = append(trees, strings.Join(events, ""))
+	}
+	expected := "(class(variable)(function(return(logical(call(super)(variable))(get(this)))))) " +
+		"(var) " +
+		"(if(unary(variable))(print(unary(group(binary(literal)(literal)))))(block(expression(assign(set(call(variable)(literal))(literal)))))) " +
+		"(while(literal)(return))"
+	if got := strings.Join(trees, " "); got != expected {
+		t.Errorf("expected\n\t%s\ngot\n\t%s", expected, got)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	// a small lint written outside the package: report calls, but not
+	// those inside functions
+	program := parseProgram(t, `f(1);
+fun g() { h(2); }
+print k(j(3));`)
+
+	calls := []string{}
+	for _, stmt := range program {
+		parser.Inspect(stmt, func(node parser.Node) bool {
+			switch n := node.(type) {
+			case parser.ASTfunction:
+				return false
+			case parser.ASTcall:
+				calls = append(calls, n.Callee.String())
+			}
+			return true
+		})
+	}
+	if got := strings.Join(calls, " "); got != "f k j" {
+		t.Errorf("expected calls f k j, got %s", got)
+	}
+}
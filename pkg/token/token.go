@@ -8,7 +8,40 @@ type Struct struct {
 	Type    Type
 	Lexeme  string
 	Literal string
-	Line    int
+	Span
+	// Err describes the problem for ERROR tokens and is nil otherwise.
+	Err error
+}
+
+// Span locates a piece of source text. Offset and Length are in bytes;
+// Line and Column are 1-based, with Column counting bytes from the start
+// of the line.
+type Span struct {
+	Line   int
+	Column int
+	Offset int
+	Length int
+}
+
+// End returns the offset just past the last byte of the span.
+func (s Span) End() int {
+	return s.Offset + s.Length
+}
+
+// Join returns the smallest span covering both s and other. A zero span
+// (for example from a node the parser synthesized) is ignored.
+func (s Span) Join(other Span) Span {
+	if s == (Span{}) {
+		return other
+	}
+	if other == (Span{}) {
+		return s
+	}
+	if other.Offset < s.Offset {
+		s, other = other, s
+	}
+	s.Length = max(s.End(), other.End()) - s.Offset
+	return s
 }
 
 func (t Struct) String() string {
@@ -59,6 +92,10 @@ const (
 	VAR
 	WHILE
 	ERROR
+	// DOC_COMMENT, WHITESPACE and COMMENT are only produced when asked for.
+	DOC_COMMENT
+	WHITESPACE
+	COMMENT
 )
 
 var KEYWORDS map[string]Type = map[string]Type{"and": AND, "class": CLASS, "else": ELSE, "false": FALSE, "for": FOR, "fun": FUN, "if": IF, "nil": NIL, "or": OR, "print": PRINT, "return": RETURN, "super": SUPER, "this": THIS, "true": TRUE, "var": VAR, "while": WHILE, "null": EOF}
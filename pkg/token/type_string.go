@@ -48,11 +48,14 @@ func _() {
 	_ = x[VAR-37]
 	_ = x[WHILE-38]
 	_ = x[ERROR-39]
+	_ = x[DOC_COMMENT-40]
+	_ = x[WHITESPACE-41]
+	_ = x[COMMENT-42]
 }
 
-const _Type_name = "EOFLEFT_PARENRIGHT_PARENLEFT_BRACERIGHT_BRACESEMICOLONCOMMAPLUSMINUSEQUALSTARBANG_EQUALEQUAL_EQUALLESS_EQUALGREATER_EQUALLESSGREATERSLASHDOTBANGSTRINGNUMBERIDENTIFIERANDCLASSELSEFALSEFORFUNIFNILORPRINTRETURNSUPERTHISTRUEVARWHILEERROR"
+const _Type_name = "EOFLEFT_PARENRIGHT_PARENLEFT_BRACERIGHT_BRACESEMICOLONCOMMAPLUSMINUSEQUALSTARBANG_EQUALEQUAL_EQUALLESS_EQUALGREATER_EQUALLESSGREATERSLASHDOTBANGSTRINGNUMBERIDENTIFIERANDCLASSELSEFALSEFORFUNIFNILORPRINTRETURNSUPERTHISTRUEVARWHILEERRORDOC_COMMENTWHITESPACECOMMENT"
 
-var _Type_index = [...]uint8{0, 3, 13, 24, 34, 45, 54, 59, 63, 68, 73, 77, 87, 98, 108, 121, 125, 132, 137, 140, 144, 150, 156, 166, 169, 174, 178, 183, 186, 189, 191, 194, 196, 201, 207, 212, 216, 220, 223, 228, 233}
+var _Type_index = [...]uint16{0, 3, 13, 24, 34, 45, 54, 59, 63, 68, 73, 77, 87, 98, 108, 121, 125, 132, 137, 140, 144, 150, 156, 166, 169, 174, 178, 183, 186, 189, 191, 194, 196, 201, 207, 212, 216, 220, 223, 228, 233, 244, 254, 261}
 
 func (i Type) String() string {
 	if i < 0 || i >= Type(len(_Type_index)-1) {
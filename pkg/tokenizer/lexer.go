@@ -0,0 +1,60 @@
+package tokenizer
+
+import (
+	"io"
+
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+// Lexer is the pull-based counterpart of Tokenize: callers ask for tokens
+// as they need them, with as much lookahead as they like, and no goroutine
+// or channel is involved. It produces exactly the tokens Tokenize would,
+// ERROR tokens included, and returns EOF forever once the input runs out.
+type Lexer struct {
+	s     *scanner
+	ahead []token.Struct // tokens scanned by Peek but not yet returned
+}
+
+// NewLexer returns a Lexer reading from r, which is consumed lazily.
+func NewLexer(r io.Reader) *Lexer {
+	return NewLexerMode(r, 0)
+}
+
+// NewLexerMode is NewLexer with the optional lexical features in mode
+// switched on.
+func NewLexerMode(r io.Reader, mode Mode) *Lexer {
+	return &Lexer{s: newScanner(r, mode)}
+}
+
+// Next returns the next token and moves past it.
+func (l *Lexer) Next() token.Struct {
+	if len(l.ahead) > 0 {
+		t := l.ahead[0]
+		l.ahead = l.ahead[1:]
+		return t
+	}
+	return l.s.next()
+}
+
+// Peek returns the token k places ahead without consuming anything; Peek(0)
+// is the token Next would return.
+func (l *Lexer) Peek(k int) token.Struct {
+	for len(l.ahead) <= k {
+		l.ahead = append(l.ahead, l.s.next())
+	}
+	return l.ahead[k]
+}
+
+// All returns an iterator over the remaining tokens, ending with EOF. It
+// has the shape of an iter.Seq[token.Struct], so it can be ranged over
+// directly once the module moves to a Go version with range-over-func.
+func (l *Lexer) All() func(yield func(token.Struct) bool) {
+	return func(yield func(token.Struct) bool) {
+		for {
+			t := l.Next()
+			if !yield(t) || t.Type == token.EOF {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tokenizer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"example.com/cjon/interpreter-starter-go/pkg/token"
+)
+
+func TestLexer(t *testing.T) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := collect(func(ch chan<- token.Struct) { Tokenize(ch, []byte(test.lines)) })
+			got := []token.Struct{}
+			NewLexer(strings.NewReader(test.lines)).All()(func(tok token.Struct) bool {
+				got = append(got, tok)
+				return true
+			})
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestLexerPeek(t *testing.T) {
+	l := NewLexer(strings.NewReader("a = b;"))
+	if tok := l.Peek(3); tok.Type != token.SEMICOLON {
+		t.Errorf("Peek(3): expected ';', got %v", tok)
+	}
+	if tok := l.Peek(0); tok.Lexeme != "a" {
+		t.Errorf("Peek(0): expected a, got %v", tok)
+	}
+	for _, expected := range []string{"a", "=", "b", ";", ""} {
+		if tok := l.Next(); tok.Lexeme != expected {
+			t.Errorf("Next: expected %q, got %v", expected, tok)
+		}
+	}
+	if tok := l.Peek(5); tok.Type != token.EOF {
+		t.Errorf("Peek past the end: expected EOF, got %v", tok)
+	}
+	if tok := l.Next(); tok.Type != token.EOF {
+		t.Errorf("Next past the end: expected EOF, got %v", tok)
+	}
+}
+
+func TestLexerAllStopsEarly(t *testing.T) {
+	l := NewLexer(strings.NewReader("1 2 3"))
+	seen := 0
+	l.All()(func(tok token.Struct) bool {
+		seen++
+		return seen < 2
+	})
+	if seen != 2 {
+		t.Errorf("expected the iterator to stop after 2 tokens, got %d", seen)
+	}
+	if tok := l.Next(); tok.Lexeme != "3" {
+		t.Errorf("expected the remaining token 3, got %v", tok)
+	}
+}
+
+// benchmarkSource is a large, realistic program for comparing the two
+// tokenizer APIs.
+var benchmarkSource = bytes.Repeat([]byte(`// compute a few fibonacci numbers
+fun fib(n) {
+  if (n <= 1) return n;
+  return fib(n - 2) + fib(n - 1);
+}
+for (var i = 0; i < 20; i = i + 1) {
+  print "fib " + "of"; print fib(i) * 1.5 / 3.25;
+}
+`), 2000)
+
+func BenchmarkTokenize(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkSource)))
+	for i := 0; i < b.N; i++ {
+		tokCh := make(chan token.Struct)
+		go Tokenize(tokCh, benchmarkSource)
+		for range tokCh {
+		}
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkSource)))
+	for i := 0; i < b.N; i++ {
+		l := NewLexer(bytes.NewReader(benchmarkSource))
+		for l.Next().Type != token.EOF {
+		}
+	}
+}
@@ -1,208 +1,702 @@
 package tokenizer
 
 import (
-	"errors"
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
-	"os"
+	"io"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
+	"example.com/cjon/interpreter-starter-go/pkg/diagnostic"
 	"example.com/cjon/interpreter-starter-go/pkg/token"
 )
 
+// Tokenize scans line and sends its tokens, finishing with EOF, before
+// closing tokens. Problems are sent in-band as ERROR tokens whose Err is a
+// diagnostic.Diagnostic; scanning carries on after them.
 func Tokenize(tokens chan<- token.Struct, line []byte) {
-	var err error = nil
-	i := 0
-	lineNumber := 1
-	peek := func() (byte, bool) {
-		if i+1 == len(line) {
-			return ' ', false
-		}
-		return line[i+1], true
-	}
-
-	tokenizeString := func() error {
-		terminated := false
-		ln := lineNumber
-		ts := []byte{}
-		for ; i < len(line); i++ {
-			if line[i] == '"' {
-				terminated = true
-				break
-			}
-			if line[i] == '\n' {
-				lineNumber++
-				break
-			}
-			ts = append(ts, line[i])
+	TokenizeReader(tokens, bytes.NewReader(line))
+}
+
+// TokenizeReader is Tokenize over a stream. Only the token currently
+// being scanned is held in memory, so it suits pipes and inputs too large
+// to read up front.
+func TokenizeReader(tokens chan<- token.Struct, r io.Reader) {
+	TokenizeContext(context.Background(), tokens, r)
+}
+
+// TokenizeContext is TokenizeReader that gives up once ctx is done, so a
+// consumer that stops reading early can cancel ctx rather than leave the
+// tokenizer blocked forever. tokens is closed either way. It returns nil
+// after sending EOF, or the cause of the cancellation. A Read already
+// blocked inside r is not interrupted.
+func TokenizeContext(ctx context.Context, tokens chan<- token.Struct, r io.Reader) error {
+	return TokenizeMode(ctx, tokens, r, 0)
+}
+
+// TokenizeMode is TokenizeContext with the optional lexical features in
+// mode switched on.
+func TokenizeMode(ctx context.Context, tokens chan<- token.Struct, r io.Reader, mode Mode) error {
+	defer close(tokens)
+	s := newScanner(r, mode)
+	for {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
 		}
-		if !terminated {
-			fmt.Fprintf(os.Stderr, "[line %d] Error: Unterminated string.\n", ln)
-			return errors.New("syntax_error")
+		t := s.next()
+		select {
+		case tokens <- t:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+		if t.Type == token.EOF {
+			return nil
 		}
-		str := string(ts)
-		qstr := "\"" + str + "\""
-		tokens <- token.Struct{token.STRING, qstr, str, lineNumber}
-		return nil
 	}
+}
 
-	tokenizeNumber := func() {
-		ts := []byte{}
-		dotSeen := false
-		for ; i < len(line); i++ {
-			// fmt.Fprintf(os.Stderr, "num (%d): %v\n", i, line[i])
-			ts = append(ts, line[i])
-			nextByte, ok := peek()
-			if !ok {
-				// at end of line
-				break
-			}
-			if nextByte == '.' {
-				if dotSeen {
-					break
-				}
-				dotSeen = true
-			} else if !unicode.IsDigit(rune(nextByte)) {
-				break
-			}
-		}
-		str := string(ts)
-		nstr := str
-		if !dotSeen {
-			nstr = nstr + ".0"
-		} else {
-			// this bit just removes trailing zeros
-			nstr = strings.TrimRight(nstr, "0")
-			// and adds one back in if there were only zeros
-			if strings.HasSuffix(nstr, ".") {
-				nstr = nstr + "0"
-			}
+// Mode selects optional lexical features. The zero Mode scans the lexical
+// grammar of the book exactly, which is what the test suites expect.
+type Mode uint
+
+const (
+	// Extended accepts the escapes \n, \t, \", \\ and \u{XXXX} in strings,
+	// allows any Unicode letter in identifiers, skips /* */ block comments,
+	// which nest, and reads 0x and 0b integers, exponents and digits
+	// grouped with underscores.
+	Extended Mode = 1 << iota
+	// DocComments sends /// comments as DOC_COMMENT tokens instead of
+	// skipping them. The parser attaches them to the declaration that
+	// follows.
+	DocComments
+	// Trivia sends runs of whitespace as WHITESPACE tokens and comments as
+	// COMMENT tokens, so that the lexemes of all the tokens, ERROR tokens
+	// included, add up to the source.
+	Trivia
+)
+
+// scanner turns a stream of bytes into tokens.
+type scanner struct {
+	r         *bufio.Reader
+	mode      Mode
+	offset    int // offset of the next unread byte
+	line      int
+	lineStart int   // offset of the first byte of the current line
+	err       error // the read error that ended the input, if any
+	reported  bool  // whether err has been sent as an ERROR token
+
+	// lexeme, start, startLine and startColumn describe the token being
+	// scanned
+	lexeme      []byte
+	start       int
+	startLine   int
+	startColumn int
+}
+
+func newScanner(r io.Reader, mode Mode) *scanner {
+	return &scanner{r: bufio.NewReader(r), mode: mode, line: 1}
+}
+
+// peek returns the next unread byte without consuming it. A failed read
+// ends the input for good.
+func (s *scanner) peek() (byte, bool) {
+	if s.err != nil {
+		return 0, false
+	}
+	b, err := s.r.Peek(1)
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
 		}
-		// restLn := line[i:]
-		// fmt.Fprintf(os.Stderr, "num (%v): %s,%s ... %s\n", dotSeen, str, nstr, restLn)
-		tokens <- token.Struct{Type: token.NUMBER, Lexeme: str, Literal: nstr}
+		return 0, false
 	}
+	return b[0], true
+}
 
-	isIdentifierByte := func(c byte) bool {
-		// Check if the byte value falls within the range of alphanumeric characters
-		return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c == '_')
+// peekRune decodes the next unread character without consuming it. It
+// only waits for as many bytes as the leading byte says the character has.
+func (s *scanner) peekRune() (rune, int) {
+	c, ok := s.peek()
+	if !ok {
+		return utf8.RuneError, 0
+	}
+	if c < utf8.RuneSelf {
+		return rune(c), 1
 	}
+	b, _ := s.r.Peek(runeLength(c))
+	return utf8.DecodeRune(b)
+}
 
-	tokenizeIdentifier := func() {
-		ts := []byte{}
-		for ; i < len(line); i++ {
-			ts = append(ts, line[i])
-			nextByte, ok := peek()
-			if !ok {
-				// at end of line
-				break
-			}
-			if !(unicode.IsDigit(rune(nextByte)) || isIdentifierByte(nextByte)) {
-				break
-			}
-		}
-		str := string(ts)
-		lexeme, ok := token.KEYWORDS[str]
+// runeLength is the length of a UTF-8 sequence starting with lead.
+func runeLength(lead byte) int {
+	switch {
+	case lead >= 0xF0:
+		return 4
+	case lead >= 0xE0:
+		return 3
+	case lead >= 0xC0:
+		return 2
+	}
+	return 1
+}
+
+// skip consumes the next byte without adding it to the lexeme.
+func (s *scanner) skip() byte {
+	c, err := s.r.ReadByte()
+	if err != nil {
+		return 0
+	}
+	s.offset++
+	if c == '\n' {
+		s.line++
+		s.lineStart = s.offset
+	}
+	return c
+}
+
+// advance consumes the next byte as part of the current lexeme.
+func (s *scanner) advance() byte {
+	c := s.skip()
+	s.lexeme = append(s.lexeme, c)
+	return c
+}
+
+func (s *scanner) peekIs(c byte) bool {
+	next, ok := s.peek()
+	return ok && next == c
+}
+
+// match consumes the next byte if it is c.
+func (s *scanner) match(c byte) bool {
+	if next, ok := s.peek(); ok && next == c {
+		s.advance()
+		return true
+	}
+	return false
+}
+
+func (s *scanner) begin() {
+	s.lexeme = s.lexeme[:0]
+	s.start, s.startLine, s.startColumn = s.offset, s.line, s.offset-s.lineStart+1
+}
+
+// span covers the current token from its first byte up to end.
+func (s *scanner) span(end int) token.Span {
+	return token.Span{Line: s.startLine, Column: s.startColumn, Offset: s.start, Length: end - s.start}
+}
+
+func (s *scanner) token(t token.Type, literal string) token.Struct {
+	return token.Struct{Type: t, Lexeme: string(s.lexeme), Literal: literal, Span: s.span(s.offset)}
+}
+
+// here is an empty span at the next unread byte.
+func (s *scanner) here() token.Span {
+	return token.Span{Line: s.line, Column: s.offset - s.lineStart + 1, Offset: s.offset}
+}
+
+// lexError reports a problem with the source from the start of the current
+// token up to end.
+func (s *scanner) lexError(code diagnostic.Code, message string, end int) token.Struct {
+	return s.lexErrorAt(code, message, s.span(end))
+}
+
+// lexErrorAt reports a problem with the part of the current token covered
+// by span. The ERROR token's lexeme is everything the token consumed.
+func (s *scanner) lexErrorAt(code diagnostic.Code, message string, span token.Span) token.Struct {
+	err := diagnostic.Diagnostic{Kind: diagnostic.Lexical, Code: code, Message: message, Span: span}
+	return token.Struct{Type: token.ERROR, Lexeme: string(s.lexeme), Literal: err.Error(), Span: err.Span, Err: err}
+}
+
+// next scans and returns the next token. Once the input is exhausted it
+// keeps returning EOF.
+func (s *scanner) next() token.Struct {
+	for {
+		s.begin()
+		c, ok := s.peek()
 		if !ok {
-			tokens <- token.Struct{token.IDENTIFIER, str, "null", lineNumber}
-		} else {
-			tokens <- token.Struct{lexeme, str, "null", lineNumber}
+			if s.err != nil && !s.reported {
+				s.reported = true
+				return s.lexError(diagnostic.ReadFailed, "Error reading input: "+s.err.Error(), s.offset)
+			}
+			return s.token(token.EOF, "null")
 		}
-	}
+		s.advance()
 
-	for ; i < len(line); i++ {
-		switch line[i] {
+		switch c {
 		case '(':
-			tokens <- token.Struct{token.LEFT_PAREN, "(", "null", lineNumber}
+			return s.token(token.LEFT_PAREN, "null")
 		case ')':
-			tokens <- token.Struct{token.RIGHT_PAREN, ")", "null", lineNumber}
+			return s.token(token.RIGHT_PAREN, "null")
 		case '{':
-			tokens <- token.Struct{token.LEFT_BRACE, "{", "null", lineNumber}
+			return s.token(token.LEFT_BRACE, "null")
 		case '}':
-			tokens <- token.Struct{token.RIGHT_BRACE, "}", "null", lineNumber}
+			return s.token(token.RIGHT_BRACE, "null")
 		case ';':
-			tokens <- token.Struct{token.SEMICOLON, ";", "null", lineNumber}
+			return s.token(token.SEMICOLON, "null")
 		case ',':
-			tokens <- token.Struct{token.COMMA, ",", "null", lineNumber}
+			return s.token(token.COMMA, "null")
 		case '+':
-			tokens <- token.Struct{token.PLUS, "+", "null", lineNumber}
+			return s.token(token.PLUS, "null")
 		case '-':
-			tokens <- token.Struct{token.MINUS, "-", "null", lineNumber}
+			return s.token(token.MINUS, "null")
 		case '*':
-			tokens <- token.Struct{token.STAR, "*", "null", lineNumber}
+			return s.token(token.STAR, "null")
+		case '.':
+			return s.token(token.DOT, "null")
 		case '!':
-			if i+1 < len(line) && line[i+1] == '=' {
-				i++
-				tokens <- token.Struct{token.BANG_EQUAL, "!=", "null", lineNumber}
-			} else {
-				tokens <- token.Struct{token.BANG, "!", "null", lineNumber}
+			if s.match('=') {
+				return s.token(token.BANG_EQUAL, "null")
 			}
+			return s.token(token.BANG, "null")
 		case '=':
-			if i+1 < len(line) && line[i+1] == '=' {
-				tokens <- token.Struct{token.EQUAL_EQUAL, "==", "null", lineNumber}
-				i++
-			} else {
-				tokens <- token.Struct{token.EQUAL, "=", "null", lineNumber}
+			if s.match('=') {
+				return s.token(token.EQUAL_EQUAL, "null")
 			}
+			return s.token(token.EQUAL, "null")
 		case '<':
-			if i+1 < len(line) && line[i+1] == '=' {
-				tokens <- token.Struct{token.LESS_EQUAL, "<=", "null", lineNumber}
-				i++
-			} else {
-				tokens <- token.Struct{token.LESS, "<", "null", lineNumber}
+			if s.match('=') {
+				return s.token(token.LESS_EQUAL, "null")
 			}
+			return s.token(token.LESS, "null")
 		case '>':
-			if i+1 < len(line) && line[i+1] == '=' {
-				tokens <- token.Struct{token.GREATER_EQUAL, ">=", "null", lineNumber}
-				i++
-			} else {
-				tokens <- token.Struct{token.GREATER, ">", "null", lineNumber}
+			if s.match('=') {
+				return s.token(token.GREATER_EQUAL, "null")
 			}
+			return s.token(token.GREATER, "null")
 		case '/':
-			if i+1 < len(line) && line[i+1] == '/' {
-				// handle comments
-				for i < len(line) {
-					if line[i] == '\n' {
-						lineNumber++
+			if s.peekIs('/') {
+				if s.mode&DocComments != 0 && s.isDocComment() {
+					return s.docComment()
+				}
+				if s.mode&Trivia != 0 {
+					s.lineComment()
+					return s.token(token.COMMENT, "null")
+				}
+				// comments run up to and including the end of the line
+				for c, ok := s.peek(); ok; c, ok = s.peek() {
+					s.skip()
+					if c == '\n' {
 						break
 					}
-					i++
 				}
-			} else {
-				tokens <- token.Struct{token.SLASH, "/", "null", lineNumber}
+				continue
+			}
+			if s.mode&Extended != 0 && s.match('*') {
+				if !s.blockComment() {
+					return s.lexError(diagnostic.UnterminatedComment, "Unterminated block comment.", s.start+2)
+				}
+				if s.mode&Trivia != 0 {
+					return s.token(token.COMMENT, "null")
+				}
+				continue
+			}
+			return s.token(token.SLASH, "null")
+		case ' ', '\t', '\n':
+			if s.mode&Trivia != 0 {
+				for s.peekIs(' ') || s.peekIs('\t') || s.peekIs('\n') {
+					s.advance()
+				}
+				return s.token(token.WHITESPACE, "null")
 			}
-		case '.':
-			tokens <- token.Struct{token.DOT, ".", "null", lineNumber}
-		case ' ':
-			// ignore
-		case '\t':
-			// ignore
-		case '\n':
-			lineNumber++
 		case '"':
-			i++
-			err = tokenizeString()
+			return s.string()
 		default:
-			if unicode.IsDigit(rune(line[i])) {
-				tokenizeNumber()
-				continue
+			if unicode.IsDigit(rune(c)) {
+				if s.mode&Extended != 0 {
+					return s.extendedNumber(c)
+				}
+				return s.number()
 			}
-			if isIdentifierByte(line[i]) {
-				tokenizeIdentifier()
-				continue
+			if isIdentifierByte(c) {
+				return s.identifier()
+			}
+			if s.mode&Extended != 0 && c >= utf8.RuneSelf {
+				r := s.finishRune(c)
+				if unicode.IsLetter(r) {
+					return s.identifier()
+				}
+				return s.lexError(diagnostic.UnexpectedCharacter, "Unexpected character: "+string(r), s.offset)
+			}
+			return s.lexError(diagnostic.UnexpectedCharacter, "Unexpected character: "+string(c), s.offset)
+		}
+	}
+}
+
+// isDocComment reports whether the comment whose first slash has been
+// consumed is a doc comment: exactly three slashes, as "////" is often
+// used for ruled lines.
+func (s *scanner) isDocComment() bool {
+	b, _ := s.r.Peek(3)
+	return len(b) >= 2 && b[1] == '/' && (len(b) == 2 || b[2] != '/')
+}
+
+// docComment scans a /// comment up to the end of the line. The literal is
+// its text, without the slashes and one following space.
+func (s *scanner) docComment() token.Struct {
+	s.lineComment()
+	text := strings.TrimSuffix(string(s.lexeme[3:]), "\r")
+	return s.token(token.DOC_COMMENT, strings.TrimPrefix(text, " "))
+}
+
+// lineComment consumes the rest of a line comment, leaving the newline.
+func (s *scanner) lineComment() {
+	for c, ok := s.peek(); ok && c != '\n'; c, ok = s.peek() {
+		s.advance()
+	}
+}
+
+// blockComment consumes the rest of a /* */ comment, including any
+// comments nested inside it. It reports false if the input ends first. The
+// comment is only kept in the lexeme when trivia is wanted.
+func (s *scanner) blockComment() bool {
+	consume := s.skip
+	if s.mode&Trivia != 0 {
+		consume = s.advance
+	}
+	depth := 1
+	for {
+		c, ok := s.peek()
+		if !ok {
+			return false
+		}
+		consume()
+		switch {
+		case c == '*' && s.peekIs('/'):
+			consume()
+			depth--
+			if depth == 0 {
+				return true
+			}
+		case c == '/' && s.peekIs('*'):
+			consume()
+			depth++
+		}
+	}
+}
+
+// finishRune consumes the rest of the UTF-8 sequence that starts with the
+// already consumed byte lead, and returns the character it encodes.
+func (s *scanner) finishRune(lead byte) rune {
+	b, _ := s.r.Peek(runeLength(lead) - 1)
+	r, size := utf8.DecodeRune(append([]byte{lead}, b...))
+	for i := 1; i < size; i++ {
+		s.advance()
+	}
+	return r
+}
+
+func (s *scanner) string() token.Struct {
+	if s.mode&Extended != 0 {
+		return s.extendedString()
+	}
+	for {
+		c, ok := s.peek()
+		if !ok {
+			// like the book, report the line the input ran out on
+			return s.lexErrorAt(diagnostic.UnterminatedString, "Unterminated string.", s.here())
+		}
+		s.advance()
+		if c == '"' {
+			break
+		}
+	}
+	str := string(s.lexeme[1 : len(s.lexeme)-1])
+	return s.token(token.STRING, str)
+}
+
+// extendedString scans a string that may span lines and contain escape
+// sequences. The literal is the decoded value. A bad escape is reported
+// once the closing quote is found, so the rest of the string is not
+// mistaken for code.
+func (s *scanner) extendedString() token.Struct {
+	var value strings.Builder
+	var bad *token.Span
+	for {
+		c, ok := s.peek()
+		if !ok {
+			return s.lexErrorAt(diagnostic.UnterminatedString, "Unterminated string.", s.here())
+		}
+		if c != '\\' {
+			s.advance()
+			if c == '"' {
+				break
+			}
+			value.WriteByte(c)
+			continue
+		}
+
+		span := s.here()
+		s.advance()
+		r, ok := s.escape()
+		span.Length = s.offset - span.Offset
+		if !ok && bad == nil {
+			bad = &span
+		}
+		value.WriteRune(r)
+	}
+	if bad != nil {
+		return s.lexErrorAt(diagnostic.InvalidEscape, "Invalid escape sequence.", *bad)
+	}
+	return s.token(token.STRING, value.String())
+}
+
+// escape consumes the rest of an escape sequence after its backslash and
+// returns the character it stands for. Nothing that could end the string
+// is consumed unless it was escaped.
+func (s *scanner) escape() (rune, bool) {
+	c, ok := s.peek()
+	if !ok {
+		return utf8.RuneError, false
+	}
+	switch c {
+	case 'n':
+		s.advance()
+		return '\n', true
+	case 't':
+		s.advance()
+		return '\t', true
+	case '"', '\\':
+		s.advance()
+		return rune(c), true
+	case 'u':
+		s.advance()
+		return s.unicodeEscape()
+	}
+	if c != '\n' {
+		s.finishRune(s.advance())
+	}
+	return utf8.RuneError, false
+}
+
+// unicodeEscape consumes the "{XXXX}" of a \u escape: one to six hex
+// digits naming a Unicode scalar value.
+func (s *scanner) unicodeEscape() (rune, bool) {
+	if !s.match('{') {
+		return utf8.RuneError, false
+	}
+	var r rune
+	digits := 0
+	for {
+		c, ok := s.peek()
+		v, hex := hexValue(c)
+		if !ok || !hex {
+			break
+		}
+		s.advance()
+		if digits < 6 {
+			r = r<<4 | v
+		}
+		digits++
+	}
+	if !s.match('}') || digits == 0 || digits > 6 || !utf8.ValidRune(r) {
+		return utf8.RuneError, false
+	}
+	return r, true
+}
+
+func hexValue(c byte) (rune, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return rune(c - '0'), true
+	case c >= 'a' && c <= 'f':
+		return rune(c-'a') + 10, true
+	case c >= 'A' && c <= 'F':
+		return rune(c-'A') + 10, true
+	}
+	return 0, false
+}
+
+func (s *scanner) number() token.Struct {
+	dotSeen := false
+	for {
+		next, ok := s.peek()
+		if !ok {
+			break
+		}
+		if next == '.' {
+			if dotSeen {
+				break
+			}
+			dotSeen = true
+		} else if !unicode.IsDigit(rune(next)) {
+			break
+		}
+		s.advance()
+	}
+	return s.token(token.NUMBER, decimalLiteral(string(s.lexeme), dotSeen))
+}
+
+// decimalLiteral normalizes the digits of a decimal number for the token's
+// literal.
+func decimalLiteral(nstr string, dotSeen bool) string {
+	if !dotSeen {
+		return nstr + ".0"
+	}
+	// this bit just removes trailing zeros
+	nstr = strings.TrimRight(nstr, "0")
+	// and adds one back in if there were only zeros
+	if strings.HasSuffix(nstr, ".") {
+		nstr = nstr + "0"
+	}
+	return nstr
+}
+
+// floatLiteral formats a number computed from a hexadecimal, binary or
+// scientific literal the way decimalLiteral would.
+func floatLiteral(v float64) string {
+	nstr := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(nstr, ".") {
+		nstr += ".0"
+	}
+	return nstr
+}
+
+// extendedNumber scans a number in the extended syntax: decimals with an
+// optional fraction and exponent, or 0x and 0b integers, all of which may
+// group digits with single underscores. Plain decimals keep the literal
+// number gives them. first is the digit already consumed.
+func (s *scanner) extendedNumber(first byte) token.Struct {
+	if first == '0' {
+		if s.match('x') || s.match('X') {
+			return s.radixNumber(16, "hexadecimal")
+		}
+		if s.match('b') || s.match('B') {
+			return s.radixNumber(2, "binary")
+		}
+	}
+
+	problem := ""
+	report := func(message string) {
+		if problem == "" {
+			problem = message
+		}
+	}
+	s.digits(10, report)
+	dotSeen, exponent := false, false
+	if s.peekIs('.') {
+		s.advance()
+		dotSeen = true
+		if next, ok := s.peek(); ok && isDigit(next, 10) {
+			s.digits(10, report)
+		} else {
+			report("Expect digits after '.'.")
+		}
+	}
+	if s.peekIs('e') || s.peekIs('E') {
+		s.advance()
+		exponent = true
+		if !s.match('+') {
+			s.match('-')
+		}
+		if next, ok := s.peek(); ok && isDigit(next, 10) {
+			s.digits(10, report)
+		} else {
+			report("Expect digits in exponent.")
+		}
+	}
+	if problem != "" {
+		return s.lexError(diagnostic.MalformedNumber, problem, s.offset)
+	}
+
+	digits := strings.ReplaceAll(string(s.lexeme), "_", "")
+	if !exponent {
+		return s.token(token.NUMBER, decimalLiteral(digits, dotSeen))
+	}
+	v, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		return s.lexError(diagnostic.MalformedNumber, "Number is too large.", s.offset)
+	}
+	return s.token(token.NUMBER, floatLiteral(v))
+}
+
+// radixNumber scans the digits of a 0x or 0b integer after its prefix.
+func (s *scanner) radixNumber(base int, name string) token.Struct {
+	prefix := string(s.lexeme)
+	if next, ok := s.peek(); !ok || !isDigit(next, base) {
+		return s.lexError(diagnostic.MalformedNumber, fmt.Sprintf("Expect %s digits after '%s'.", name, prefix), s.offset)
+	}
+
+	problem := ""
+	s.digits(base, func(message string) {
+		if problem == "" {
+			problem = message
+		}
+	})
+	if next, ok := s.peek(); ok && problem == "" && isDigit(next, 10) {
+		s.advance()
+		problem = fmt.Sprintf("Invalid digit '%c' in %s number.", next, name)
+	}
+	if problem != "" {
+		return s.lexError(diagnostic.MalformedNumber, problem, s.offset)
+	}
+
+	v := 0.0
+	for _, c := range s.lexeme[len(prefix):] {
+		if c != '_' {
+			d, _ := hexValue(c)
+			v = v*float64(base) + float64(d)
+		}
+	}
+	return s.token(token.NUMBER, floatLiteral(v))
+}
+
+// digits consumes a run of digits in base, each underscore in which must
+// sit between two digits. The digit before the run has been consumed.
+func (s *scanner) digits(base int, report func(string)) {
+	for {
+		next, ok := s.peek()
+		switch {
+		case ok && isDigit(next, base):
+			s.advance()
+		case ok && next == '_':
+			s.advance()
+			if after, ok := s.peek(); !ok || !isDigit(after, base) {
+				report("Digit separator '_' must be between digits.")
+				for s.peekIs('_') {
+					s.advance()
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isDigit(c byte, base int) bool {
+	v, ok := hexValue(c)
+	return ok && int(v) < base
+}
+
+func isIdentifierByte(c byte) bool {
+	// Check if the byte value falls within the range of alphanumeric characters
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c == '_')
+}
+
+func (s *scanner) identifier() token.Struct {
+	for {
+		next, ok := s.peek()
+		if ok && s.mode&Extended != 0 && next >= utf8.RuneSelf {
+			r, size := s.peekRune()
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			for i := 0; i < size; i++ {
+				s.advance()
 			}
-			errChar := string(line[i])
-			errLinePrefix := fmt.Sprintf("[line %d] Error:", lineNumber)
-			errStr := fmt.Sprintf("%s Unexpected character: %s\n", errLinePrefix, errChar)
-			err = errors.New(errStr)
+			continue
 		}
-		if err != nil {
-			tokens <- token.Struct{token.ERROR, "", err.Error(), lineNumber}
+		if !ok || !(unicode.IsDigit(rune(next)) || isIdentifierByte(next)) {
+			break
 		}
-		// if err != nil {
-		// 	break
-		// }
+		s.advance()
+	}
+	str := string(s.lexeme)
+	if keyword, ok := token.KEYWORDS[str]; ok {
+		return s.token(keyword, "null")
 	}
-	tokens <- token.Struct{token.EOF, "", "null", lineNumber}
-	close(tokens)
+	return s.token(token.IDENTIFIER, "null")
 }
@@ -1,10 +1,14 @@
 package tokenizer
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"example.com/cjon/interpreter-starter-go/pkg/token"
 )
@@ -147,6 +151,30 @@ EOF  null
 `,
 		output: `STRING "baz" baz
 EOF  null
+`,
+		retval: 65,
+	},
+	{
+		name: "String spans lines",
+		lines: `"one
+two" @`,
+		errors: `[line 2] Error: Unexpected character: @
+`,
+		output: `STRING "one
+two" one
+two
+EOF  null
+`,
+		retval: 65,
+	},
+	{
+		name: "String unterminated across lines",
+		lines: `"one
+two
+`,
+		errors: `[line 3] Error: Unterminated string.
+`,
+		output: `EOF  null
 `,
 		retval: 65,
 	},
@@ -781,36 +809,261 @@ EOF  null
 	},
 }
 
-func doTest(lines []byte) (string, string, int) {
+var extendedTests []testStruct = []testStruct{
+	{
+		name:   "escape sequences",
+		lines:  `"say \"hi\"\n" "back\\slash" "\u{e9}t\u{E9} \u{1F600}" "a\tb"`,
+		errors: ``,
+		output: `STRING "say \"hi\"\n" say "hi"
+
+STRING "back\\slash" back\slash
+STRING "\u{e9}t\u{E9} \u{1F600}" été 😀
+STRING "a\tb" a` + "\t" + `b
+EOF  null
+`,
+		retval: 0,
+	},
+	{
+		name: "invalid escape sequences",
+		lines: `"\q" "\u{110000}" "\u{zz}" "\u1" "ok"
+"\u{}"`,
+		errors: `[line 1] Error: Invalid escape sequence.
+[line 1] Error: Invalid escape sequence.
+[line 1] Error: Invalid escape sequence.
+[line 1] Error: Invalid escape sequence.
+[line 2] Error: Invalid escape sequence.
+`,
+		output: `STRING "ok" ok
+EOF  null
+`,
+		retval: 65,
+	},
+	{
+		name: "multi-line strings",
+		lines: `print "one
+two";
+@`,
+		errors: `[line 3] Error: Unexpected character: @
+`,
+		output: `PRINT print null
+STRING "one
+two" one
+two
+SEMICOLON ; null
+EOF  null
+`,
+		retval: 65,
+	},
+	{
+		name: "unterminated multi-line string",
+		lines: `var s = "one
+two`,
+		errors: `[line 2] Error: Unterminated string.
+`,
+		output: `VAR var null
+IDENTIFIER s null
+EQUAL = null
+EOF  null
+`,
+		retval: 65,
+	},
+	{
+		name: "unicode identifiers",
+		lines: `var café = naïve_2 + Ωmega + 日本;
+€`,
+		errors: `[line 2] Error: Unexpected character: €
+`,
+		output: `VAR var null
+IDENTIFIER café null
+EQUAL = null
+IDENTIFIER naïve_2 null
+PLUS + null
+IDENTIFIER Ωmega null
+PLUS + null
+IDENTIFIER 日本 null
+SEMICOLON ; null
+EOF  null
+`,
+		retval: 65,
+	},
+}
+
+var commentTests []testStruct = []testStruct{
+	{
+		name: "block comments",
+		lines: `1 /* one */ 2 /* outer /* inner */ still
+outer */ 3 / * /**/ 4
+/* never closed /* */`,
+		errors: `[line 3] Error: Unterminated block comment.
+`,
+		output: `NUMBER 1 1.0
+NUMBER 2 2.0
+NUMBER 3 3.0
+SLASH / null
+STAR * null
+NUMBER 4 4.0
+EOF  null
+`,
+		retval: 65,
+	},
+	{
+		name: "doc comments",
+		lines: `/// Adds two numbers.
+///
+//// not a doc comment
+// nor this
+fun add(a, b) { return a + b; } ///trailing`,
+		errors: ``,
+		output: `DOC_COMMENT /// Adds two numbers. Adds two numbers.
+DOC_COMMENT /// ` + `
+FUN fun null
+IDENTIFIER add null
+LEFT_PAREN ( null
+IDENTIFIER a null
+COMMA , null
+IDENTIFIER b null
+RIGHT_PAREN ) null
+LEFT_BRACE { null
+RETURN return null
+IDENTIFIER a null
+PLUS + null
+IDENTIFIER b null
+SEMICOLON ; null
+RIGHT_BRACE } null
+DOC_COMMENT ///trailing trailing
+EOF  null
+`,
+		retval: 0,
+	},
+}
+
+var numberTests []testStruct = []testStruct{
+	{
+		name:   "extended numbers",
+		lines:  `0xff 0XdeAD_beef 0b1010 0B1_0 1_000_000 3.141_592 1e-9 2.5E+3 6e0 1_0e1_0`,
+		errors: ``,
+		output: `NUMBER 0xff 255.0
+NUMBER 0XdeAD_beef 3735928559.0
+NUMBER 0b1010 10.0
+NUMBER 0B1_0 2.0
+NUMBER 1_000_000 1000000.0
+NUMBER 3.141_592 3.141592
+NUMBER 1e-9 0.000000001
+NUMBER 2.5E+3 2500.0
+NUMBER 6e0 6.0
+NUMBER 1_0e1_0 100000000000.0
+EOF  null
+`,
+		retval: 0,
+	},
+	{
+		name: "malformed numbers",
+		lines: `1. 0x 0b 1__0 2_ 3._5 4e 5e+ 0b102 0x_1 1e999
+6`,
+		errors: `[line 1] Error: Expect digits after '.'.
+[line 1] Error: Expect hexadecimal digits after '0x'.
+[line 1] Error: Expect binary digits after '0b'.
+[line 1] Error: Digit separator '_' must be between digits.
+[line 1] Error: Digit separator '_' must be between digits.
+[line 1] Error: Expect digits after '.'.
+[line 1] Error: Expect digits in exponent.
+[line 1] Error: Expect digits in exponent.
+[line 1] Error: Invalid digit '2' in binary number.
+[line 1] Error: Expect hexadecimal digits after '0x'.
+[line 1] Error: Number is too large.
+`,
+		output: `IDENTIFIER _5 null
+IDENTIFIER _1 null
+NUMBER 6 6.0
+EOF  null
+`,
+		retval: 65,
+	},
+}
+
+func doTest(lines []byte, mode Mode) (string, string, int) {
 	output := ""
+	errs := ""
 	retval := 0
 
-	errCh := make(chan error)
 	tokCh := make(chan token.Struct)
-
-	oldStderr := os.Stderr
-	r, w, _ := os.Pipe()
-	os.Stderr = w
-	go Tokenize(tokCh, errCh, lines)
+	go TokenizeMode(context.Background(), tokCh, bytes.NewReader(lines), mode)
 	for t := range tokCh {
+		if t.Type == token.ERROR {
+			errs = errs + t.Err.Error() + "\n"
+			retval = 65
+			continue
+		}
 		output = output + fmt.Sprintln(t)
 	}
-	os.Stderr = oldStderr
-	w.Close()
+	return output, errs, retval
+}
 
-	syntaxErrs, _ := io.ReadAll(r)
+func TestTokenize(t *testing.T) {
+	runTests(t, tests, 0)
+}
+
+func TestTokenizeExtended(t *testing.T) {
+	runTests(t, extendedTests, Extended)
+}
 
-	err := <-errCh
-	if err != nil {
-		retval = 65
+func TestTokenizeComments(t *testing.T) {
+	runTests(t, commentTests, Extended|DocComments)
+}
+
+func TestTokenizeExtendedNumbers(t *testing.T) {
+	runTests(t, numberTests, Extended)
+}
+
+func TestExtendedDecimalsKeepTheirLiteral(t *testing.T) {
+	for _, lines := range []string{"0", "007", "42", "1.5", "200.00", "34.7.34.70000", "0.000", "65.4321"} {
+		book, _, _ := doTest([]byte(lines), 0)
+		extended, _, _ := doTest([]byte(lines), Extended)
+		if book != extended {
+			t.Errorf("%s: book mode gives %q, extended mode %q", lines, book, extended)
+		}
 	}
-	return output, string(syntaxErrs), retval
 }
 
-func TestTokenize(t *testing.T) {
+func TestTriviaIsLossless(t *testing.T) {
+	tables := []struct {
+		tests []testStruct
+		mode  Mode
+	}{
+		{tests, 0},
+		{extendedTests, Extended},
+		{commentTests, Extended | DocComments},
+		{numberTests, Extended},
+	}
+	for _, table := range tables {
+		for _, test := range table.tests {
+			var sb strings.Builder
+			for _, tok := range collect(func(ch chan<- token.Struct) {
+				TokenizeMode(context.Background(), ch, strings.NewReader(test.lines), table.mode|Trivia)
+			}) {
+				sb.WriteString(tok.Lexeme)
+			}
+			if sb.String() != test.lines {
+				t.Errorf("%s: lexemes give %q, source is %q", test.name, sb.String(), test.lines)
+			}
+		}
+	}
+}
+
+func TestTriviaTokens(t *testing.T) {
+	lines := "a  // one\n\t/* two */b"
+	expected := "IDENTIFIER a null\nWHITESPACE    null\nCOMMENT // one null\nWHITESPACE \n\t null\n" +
+		"COMMENT /* two */ null\nIDENTIFIER b null\nEOF  null\n"
+	output, _, _ := doTest([]byte(lines), Extended|Trivia)
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func runTests(t *testing.T, tests []testStruct, mode Mode) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			output, errs, retval := doTest([]byte(test.lines))
+			output, errs, retval := doTest([]byte(test.lines), mode)
 			if test.output != output {
 				t.Errorf("%s: output does not match:\n\texpected '%#v'\n\tgot    : '%#v'\n", test.name, test.output, output)
 			}
@@ -823,3 +1076,134 @@ func TestTokenize(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenizeSpans(t *testing.T) {
+	lines := "var x = 12.5;\n  x >= \"s\" // c\n@"
+	expected := []token.Span{
+		{Line: 1, Column: 1, Offset: 0, Length: 3},   // var
+		{Line: 1, Column: 5, Offset: 4, Length: 1},   // x
+		{Line: 1, Column: 7, Offset: 6, Length: 1},   // =
+		{Line: 1, Column: 9, Offset: 8, Length: 4},   // 12.5
+		{Line: 1, Column: 13, Offset: 12, Length: 1}, // ;
+		{Line: 2, Column: 3, Offset: 16, Length: 1},  // x
+		{Line: 2, Column: 5, Offset: 18, Length: 2},  // >=
+		{Line: 2, Column: 8, Offset: 21, Length: 3},  // "s"
+		{Line: 3, Column: 1, Offset: 30, Length: 1},  // @
+		{Line: 3, Column: 2, Offset: 31, Length: 0},  // EOF
+	}
+
+	tokCh := make(chan token.Struct)
+	go Tokenize(tokCh, []byte(lines))
+	i := 0
+	for tok := range tokCh {
+		if i >= len(expected) {
+			t.Fatalf("unexpected extra token %v", tok)
+		}
+		if tok.Span != expected[i] {
+			t.Errorf("token %d (%v): expected span %+v, got %+v", i, tok, expected[i], tok.Span)
+		}
+		if tok.Type != token.ERROR && tok.Type != token.EOF && lines[tok.Offset:tok.End()] != tok.Lexeme {
+			t.Errorf("token %d: span covers %q, lexeme is %q", i, lines[tok.Offset:tok.End()], tok.Lexeme)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("expected %d tokens, got %d", len(expected), i)
+	}
+}
+
+func TestTokenizeReader(t *testing.T) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := collect(func(ch chan<- token.Struct) { Tokenize(ch, []byte(test.lines)) })
+			got := collect(func(ch chan<- token.Struct) {
+				TokenizeReader(ch, iotest.OneByteReader(strings.NewReader(test.lines)))
+			})
+			if len(got) != len(expected) {
+				t.Fatalf("expected %d tokens, got %d", len(expected), len(got))
+			}
+			for i := range expected {
+				if fmt.Sprint(got[i], got[i].Span) != fmt.Sprint(expected[i], expected[i].Span) {
+					t.Errorf("token %d: expected %v, got %v", i, expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenizeReaderLargeInput(t *testing.T) {
+	const statements = 100000
+	r := io.LimitReader(&repeatReader{s: "print 1;\n"}, int64(statements*len("print 1;\n")))
+	tokCh := make(chan token.Struct)
+	go TokenizeReader(tokCh, r)
+	count := 0
+	var last token.Struct
+	for tok := range tokCh {
+		count++
+		last = tok
+	}
+	if count != statements*3+1 {
+		t.Errorf("expected %d tokens, got %d", statements*3+1, count)
+	}
+	if last.Type != token.EOF || last.Line != statements+1 {
+		t.Errorf("expected EOF on line %d, got %v on line %d", statements+1, last, last.Line)
+	}
+}
+
+func TestTokenizeReaderError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("print 1"), iotest.ErrReader(fmt.Errorf("disk on fire")))
+	toks := collect(func(ch chan<- token.Struct) { TokenizeReader(ch, r) })
+	got := ""
+	for _, tok := range toks {
+		got += tok.Literal + "\n"
+	}
+	expected := "null\n1.0\n[line 1] Error: Error reading input: disk on fire\nnull\n"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestTokenizeContextCancel(t *testing.T) {
+	stop := errors.New("consumer went away")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	tokCh := make(chan token.Struct)
+	done := make(chan error)
+	go func() { done <- TokenizeContext(ctx, tokCh, &repeatReader{s: "print 1;\n"}) }()
+
+	for i := 0; i < 3; i++ {
+		<-tokCh
+	}
+	cancel(stop)
+	if err := <-done; !errors.Is(err, stop) {
+		t.Errorf("expected %v, got %v", stop, err)
+	}
+	if _, ok := <-tokCh; ok {
+		t.Errorf("expected tokens to be closed")
+	}
+}
+
+func collect(tokenize func(chan<- token.Struct)) []token.Struct {
+	tokCh := make(chan token.Struct)
+	go tokenize(tokCh)
+	toks := []token.Struct{}
+	for tok := range tokCh {
+		toks = append(toks, tok)
+	}
+	return toks
+}
+
+// repeatReader endlessly repeats a string.
+type repeatReader struct {
+	s   string
+	pos int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.s[r.pos:])
+		n += c
+		r.pos = (r.pos + c) % len(r.s)
+	}
+	return n, nil
+}